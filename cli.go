@@ -0,0 +1,1197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// exit codes of the command line tool
+const (
+	exitOK = iota
+	// exitFailure is returned on errors and when a service failed
+	exitFailure
+	exitUsage
+	// exitNotRunning is returned by commands that require the running stack
+	exitNotRunning
+)
+
+const usage = `Usage: services [-f services.yml] <command> [arguments]
+
+Commands:
+  up [-d] [services...]  start services and print their output until Ctrl-C,
+                         -d runs the stack in background, -tui shows the terminal UI
+  down                   stop the running stack
+  start <services...>    start services of the running stack
+  stop <services...>     stop services of the running stack
+  restart [services...]  restart services of the running stack, all if none are given
+  status                 print states of services
+  events [services...]   print messages of the running stack
+  logs [-f] [service]    print logs of the service or all services
+  graph [-format f]      print requirements of services as text, dot or mermaid,
+                         -state colors services of the running stack by states
+  analyze [-json]        print the startup time of services and the critical path
+  check                  check the config
+`
+
+// cli runs commands of the command line tool
+type cli struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	configPath string
+}
+
+// runCLI runs the command and returns the exit code
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	c := &cli{
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	flags := flag.NewFlagSet("services", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&c.configPath, "f", DefaultConfigFile, "stack config file")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	commands := map[string]func(args []string) int{
+		"up":      c.up,
+		"down":    c.down,
+		"start":   c.start,
+		"stop":    c.stop,
+		"restart": c.restart,
+		"status":  c.status,
+		"events":  c.events,
+		"logs":    c.logs,
+		"graph":   c.graph,
+		"analyze": c.analyze,
+		"check":   c.check,
+	}
+
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown command %s\n", flags.Arg(0))
+		flags.Usage()
+
+		return exitUsage
+	}
+
+	return command(flags.Args()[1:])
+}
+
+func (c *cli) flagSet(name string, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: services %s [flags] %s\n", name, arguments)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+func (c *cli) fail(err error) int {
+	fmt.Fprintln(c.stderr, "Error:", err)
+
+	return exitFailure
+}
+
+func (c *cli) loadConfig() (*StackConfig, error) {
+	return LoadConfig(c.configPath)
+}
+
+// runDir returns the run directory of the config
+func (c *cli) runDir() (runDir, error) {
+	config, err := c.loadConfig()
+	if err != nil {
+		return runDir{}, err
+	}
+
+	return runDir{path: config.RunPath()}, nil
+}
+
+func (c *cli) up(args []string) int {
+	flags := c.flagSet("up", "[services...]")
+	timestamps := flags.Bool("timestamps", false, "print times of messages")
+	noColor := flags.Bool("no-color", false, "disable colors")
+	detach := flags.Bool("d", false, "run in background")
+	httpAddress := flags.String("http", "", "address of the HTTP API, overrides the config")
+	metricsAddress := flags.String("metrics", "", "address of Prometheus metrics, overrides the config")
+	interactive := flags.Bool("tui", false, "show the terminal UI instead of the output")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *detach && *interactive {
+		fmt.Fprintln(c.stderr, "-d and -tui can not be used together")
+		return exitUsage
+	}
+
+	config, err := c.loadConfig()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	names := flags.Args()
+	for _, name := range names {
+		if !config.exists(name) {
+			fmt.Fprintf(c.stderr, "Unknown service %s\n", name)
+			return exitUsage
+		}
+	}
+
+	dir := runDir{path: config.RunPath()}
+
+	if *detach {
+		return c.detach(dir, flags)
+	}
+
+	if err := dir.lock(); err != nil {
+		return c.fail(err)
+	}
+	defer dir.unlock()
+
+	logs, err := NewLogSink(dir.logsPath(), config.Rotation(), true)
+	if err != nil {
+		return c.fail(err)
+	}
+	defer logs.Close()
+
+	sm := NewServiceManager()
+	events := NewBroadcaster()
+	config.Register(sm)
+	sm.AddSink(logs)
+	sm.AddSink(events)
+
+	metrics := NewMetrics(sm)
+	sm.AddSink(metrics)
+
+	// actions is nil without TUI
+	var actions <-chan TUIAction
+
+	if *interactive {
+		tui, closeTUI, err := c.openTUI(sm, dir)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer closeTUI()
+
+		sm.AddSink(tui)
+		actions = tui.Actions()
+	} else {
+		sm.AddSink(NewConsole(c.stdout, consoleNames(config), ConsoleOptions{
+			Color:      !*noColor && c.isTerminal(),
+			Timestamps: *timestamps,
+		}))
+	}
+
+	output, err := sm.Init()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	var (
+		// servers closed with the manager if up fails before the main loop
+		closers []io.Closer
+		serving = false
+	)
+
+	defer func() {
+		if serving {
+			return
+		}
+
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+
+		// the manager is stopped after poll started
+		go func() {
+			for range output {
+			}
+		}()
+		sm.Close()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	shutdown := make(chan struct{}, 1)
+
+	server, err := ListenControl(dir.socketPath(), sm, events, func() {
+		select {
+		case shutdown <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return c.fail(err)
+	}
+
+	closers = append(closers, server)
+
+	go server.Serve()
+
+	if *httpAddress != "" {
+		config.HTTP.Address = *httpAddress
+	}
+
+	if *metricsAddress != "" {
+		config.Metrics.Address = *metricsAddress
+	}
+
+	metricsServer, err := serveMetrics(config, metrics)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if metricsServer != nil {
+		closers = append(closers, metricsServer)
+	}
+
+	api, httpServer, err := c.serveHTTP(config, sm, events)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	// the manager and servers are closed by stop from now
+	serving = true
+
+	var (
+		// tasks are sent in goroutines because the manager waits for output to be read
+		tasks   sync.WaitGroup
+		closing = false
+		stop    = func() {
+			closing = true
+
+			go func() {
+				tasks.Wait()
+
+				if httpServer != nil {
+					api.Close()
+
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					_ = httpServer.Shutdown(ctx)
+					cancel()
+				}
+
+				if metricsServer != nil {
+					metricsServer.Close()
+				}
+
+				server.Close()
+				sm.Close()
+			}()
+		}
+	)
+
+	tasks.Add(1)
+
+	go func() {
+		defer tasks.Done()
+		startServices(sm, config, names)
+	}()
+
+loop:
+	for {
+		select {
+		case message, ok := <-output:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			status := sm.Status()
+			if err := dir.writeState(status); err != nil {
+				log.Print("Error writing state: ", err)
+			}
+
+			if !closing && allExited(status) {
+				stop()
+			}
+		case <-shutdown:
+			if !closing {
+				stop()
+			}
+		case action := <-actions:
+			switch {
+			case action.Command == ControlShutdown && closing:
+				fmt.Fprintln(c.stderr, "Forced exit")
+				return exitFailure
+			case action.Command == ControlShutdown:
+				stop()
+			case !closing:
+				tasks.Add(1)
+
+				go func() {
+					defer tasks.Done()
+					applyAction(sm, action)
+				}()
+			}
+		case sig := <-signals:
+			switch {
+			case sig == syscall.SIGHUP && !closing:
+				tasks.Add(1)
+
+				go func() {
+					defer tasks.Done()
+					restartServices(sm, sm.Status())
+				}()
+			case sig == syscall.SIGHUP:
+			case closing:
+				fmt.Fprintln(c.stderr, "Forced exit")
+				return exitFailure
+			default:
+				stop()
+			}
+		}
+	}
+
+	status := sm.Status()
+	if err := dir.writeState(status); err != nil {
+		log.Print("Error writing state: ", err)
+	}
+
+	for _, service := range status {
+		if service.State == StateFailed {
+			return exitFailure
+		}
+	}
+
+	return exitOK
+}
+
+// serveHTTP starts HTTPAPI if the address is configured
+func (c *cli) serveHTTP(config *StackConfig, sm *ServiceManager, events *Broadcaster) (*HTTPAPI, *http.Server, error) {
+	if config.HTTP.Address == "" {
+		return nil, nil, nil
+	}
+
+	address := localAddress(config.HTTP.Address)
+	if !isLoopbackAddress(address) && config.HTTP.Token == "" {
+		log.Printf("HTTP API on %s is not protected by a token", address)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	api := NewHTTPAPI(sm, events, config.HTTP.Token)
+	server := &http.Server{
+		Handler: api,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Print("HTTP API error: ", err)
+		}
+	}()
+
+	log.Printf("HTTP API is listening on http://%s, the dashboard is on http://%s/", listener.Addr(), listener.Addr())
+
+	return api, server, nil
+}
+
+// openTUI switches the terminal to raw mode and starts TUI, the log is written to the daemon log.
+// The returned function restores the terminal
+func (c *cli) openTUI(sm *ServiceManager, dir runDir) (*TUI, func(), error) {
+	stdout, ok := c.stdout.(*os.File)
+	if !ok || !IsTerminal(stdout) || !IsTerminal(os.Stdin) {
+		return nil, nil, fmt.Errorf("terminal UI requires a terminal")
+	}
+
+	logFile, err := os.OpenFile(dir.daemonLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		logFile.Close()
+		return nil, nil, err
+	}
+
+	tui := NewTUI(sm, stdout, func() (int, int) {
+		width, height, err := terminalSize(int(stdout.Fd()))
+		if err != nil || width == 0 || height == 0 {
+			return 80, 24
+		}
+
+		return width, height
+	})
+
+	log.SetOutput(logFile)
+	tui.Start(os.Stdin)
+
+	return tui, func() {
+		tui.Close()
+		_ = restore()
+
+		log.SetOutput(os.Stderr)
+		logFile.Close()
+	}, nil
+}
+
+// applyAction applies the action of TUI except ControlShutdown
+func applyAction(sm *ServiceManager, action TUIAction) {
+	switch action.Command {
+	case ControlStart:
+		sm.Start(action.Name)
+	case ControlStop:
+		sm.Stop(action.Name)
+	case ControlRestart:
+		sm.Restart(action.Name)
+	}
+}
+
+// serveMetrics serves Metrics on /metrics if the address is configured
+func serveMetrics(config *StackConfig, metrics *Metrics) (*http.Server, error) {
+	if config.Metrics.Address == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", localAddress(config.Metrics.Address))
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+
+	server := &http.Server{
+		Handler: mux,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Print("metrics error: ", err)
+		}
+	}()
+
+	log.Printf("metrics are served on http://%s/metrics", listener.Addr())
+
+	return server, nil
+}
+
+func (c *cli) isTerminal() bool {
+	f, ok := c.stdout.(*os.File)
+
+	return ok && IsTerminal(f)
+}
+
+// consoleNames returns names of services and instances of templates with replicas
+func consoleNames(config *StackConfig) []string {
+	names := config.Names()
+
+	for _, name := range config.Names() {
+		for i := 1; i <= config.Services[name].Replicas; i++ {
+			names = append(names, name+strconv.Itoa(i))
+		}
+	}
+
+	return names
+}
+
+// startServices starts the services, all services if names are empty.
+// Templates with replicas are scaled
+func startServices(sm *ServiceManager, config *StackConfig, names []string) {
+	all := len(names) == 0
+	if all {
+		names = config.Names()
+	}
+
+	for _, name := range names {
+		service, ok := config.Services[name]
+
+		switch {
+		case ok && service.Replicas > 0:
+			if err := sm.Scale(name, service.Replicas); err != nil {
+				log.Print(err)
+			}
+		case ok && isTemplateName(name) && all:
+			// instances are started by requirements
+		default:
+			sm.Start(name)
+		}
+	}
+}
+
+// restartServices restarts started services, instances are restarted by their templates
+func restartServices(sm *ServiceManager, status []ServiceStatus) {
+	for _, service := range status {
+		if template, instance := splitInstanceName(service.Name); template != "" && instance != "" {
+			continue
+		}
+
+		if isStartedState(service.State) {
+			sm.Restart(service.Name)
+		}
+	}
+}
+
+// allExited checks that services were started and none of them is started now
+func allExited(status []ServiceStatus) bool {
+	started := false
+
+	for _, service := range status {
+		if isStartedState(service.State) {
+			return false
+		}
+
+		started = started || service.started
+	}
+
+	return started
+}
+
+func (c *cli) down(args []string) int {
+	flags := c.flagSet("down", "")
+	timeout := flags.Duration("timeout", 30*time.Second, "time to wait for services to stop")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	return c.signal(syscall.SIGTERM, *timeout)
+}
+
+func (c *cli) start(args []string) int {
+	return c.serviceCommand(ControlStart, args, true)
+}
+
+func (c *cli) stop(args []string) int {
+	return c.serviceCommand(ControlStop, args, true)
+}
+
+func (c *cli) restart(args []string) int {
+	return c.serviceCommand(ControlRestart, args, false)
+}
+
+// serviceCommand sends the command with service names to the running stack
+func (c *cli) serviceCommand(command string, args []string, required bool) int {
+	arguments := "[services...]"
+	if required {
+		arguments = "<services...>"
+	}
+
+	flags := c.flagSet(command, arguments)
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if required && flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	client, code := c.dial()
+	if client == nil {
+		return code
+	}
+	defer client.Close()
+
+	if _, err := client.Call(ControlRequest{Command: command, Names: flags.Args()}); err != nil {
+		return c.fail(err)
+	}
+
+	return exitOK
+}
+
+// dial connects to the running stack, the exit code is returned if it fails
+func (c *cli) dial() (*ControlClient, int) {
+	dir, err := c.runDir()
+	if err != nil {
+		return nil, c.fail(err)
+	}
+
+	if _, err := dir.pid(); err != nil {
+		if err == ErrNotRunning {
+			fmt.Fprintln(c.stderr, err)
+			return nil, exitNotRunning
+		}
+
+		return nil, c.fail(err)
+	}
+
+	client, err := DialControl(dir.socketPath())
+	if err != nil {
+		return nil, c.fail(err)
+	}
+
+	return client, exitOK
+}
+
+// detach starts the manager with the same arguments in background
+// and waits until it accepts control connections
+func (c *cli) detach(dir runDir, flags *flag.FlagSet) int {
+	if pid, err := dir.pid(); err == nil {
+		return c.fail(fmt.Errorf("stack is already running with pid %d", pid))
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	configPath, err := filepath.Abs(c.configPath)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	args := []string{"-f", configPath, "up"}
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "d" {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	args = append(args, flags.Args()...)
+
+	if err := os.MkdirAll(dir.path, 0755); err != nil {
+		return c.fail(err)
+	}
+
+	daemonLog, err := os.OpenFile(dir.daemonLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return c.fail(err)
+	}
+	defer daemonLog.Close()
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stderr = daemonLog
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return c.fail(err)
+	}
+
+	exited := make(chan struct{})
+
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(10 * time.Second)
+
+	for {
+		select {
+		case <-exited:
+			return c.fail(fmt.Errorf("stack exited, see %s", dir.daemonLogPath()))
+		case <-timeout:
+			return c.fail(fmt.Errorf("stack was not started in time, see %s", dir.daemonLogPath()))
+		case <-ticker.C:
+			client, err := DialControl(dir.socketPath())
+			if err != nil {
+				continue
+			}
+
+			client.Close()
+			fmt.Fprintf(c.stdout, "Stack is running with pid %d\n", cmd.Process.Pid)
+
+			return exitOK
+		}
+	}
+}
+
+func (c *cli) events(args []string) int {
+	flags := c.flagSet("events", "[services...]")
+	timestamps := flags.Bool("timestamps", false, "print times of messages")
+	noColor := flags.Bool("no-color", false, "disable colors")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	client, code := c.dial()
+	if client == nil {
+		return code
+	}
+	defer client.Close()
+
+	response, err := client.Call(ControlRequest{Command: ControlStatus})
+	if err != nil {
+		return c.fail(err)
+	}
+
+	names := make([]string, 0, len(response.Status))
+	for _, status := range response.Status {
+		names = append(names, status.Name)
+	}
+
+	console := NewConsole(c.stdout, names, ConsoleOptions{
+		Color:      !*noColor && c.isTerminal(),
+		Timestamps: *timestamps,
+	})
+
+	if _, err := client.Call(ControlRequest{Command: ControlSubscribe, Names: flags.Args()}); err != nil {
+		return c.fail(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		<-signals
+		client.Close()
+	}()
+
+	for {
+		response, err := client.Next()
+		if err != nil {
+			// the stack was stopped or the client was closed by the signal
+			return exitOK
+		}
+
+		if response.Event != nil {
+			console.HandleMessage(*response.Event)
+		}
+	}
+}
+
+// signal sends the signal to the running manager and waits for it to exit if timeout is not zero
+func (c *cli) signal(sig syscall.Signal, timeout time.Duration) int {
+	dir, err := c.runDir()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	pid, err := dir.pid()
+	if err == ErrNotRunning {
+		fmt.Fprintln(c.stderr, err)
+		return exitNotRunning
+	}
+
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if err := signalProcess(pid, sig); err != nil {
+		return c.fail(err)
+	}
+
+	if timeout == 0 {
+		return exitOK
+	}
+
+	for deadline := time.Now().Add(timeout); isProcessAlive(pid); {
+		if time.Now().After(deadline) {
+			return c.fail(fmt.Errorf("stack was not stopped in %s", timeout))
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return exitOK
+}
+
+func (c *cli) status(args []string) int {
+	flags := c.flagSet("status", "")
+	asJSON := flags.Bool("json", false, "print status as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	dir, err := c.runDir()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	_, err = dir.pid()
+	if err != nil && err != ErrNotRunning {
+		return c.fail(err)
+	}
+
+	running := err == nil
+
+	status, err := c.liveStatus(dir, running)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(c.stderr, ErrNotRunning)
+		return exitNotRunning
+	}
+
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(status); err != nil {
+			return c.fail(err)
+		}
+	} else {
+		printStatus(c.stdout, status)
+	}
+
+	if !running {
+		fmt.Fprintln(c.stderr, ErrNotRunning)
+		return exitNotRunning
+	}
+
+	return exitOK
+}
+
+// liveStatus returns the status of the running stack or the last saved status
+func (c *cli) liveStatus(dir runDir, running bool) ([]ServiceStatus, error) {
+	if running {
+		if client, err := DialControl(dir.socketPath()); err == nil {
+			defer client.Close()
+
+			response, err := client.Call(ControlRequest{Command: ControlStatus})
+			if err == nil {
+				return response.Status, nil
+			}
+		}
+	}
+
+	return dir.readState()
+}
+
+func printStatus(w io.Writer, status []ServiceStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tSTATE\tPID\tSINCE\tRESTARTS\tCPU\tRSS\tEXIT\tERROR")
+
+	for _, service := range status {
+		var (
+			pid   = "-"
+			since = "-"
+			cpu   = "-"
+			rss   = "-"
+			exit  = "-"
+		)
+
+		if service.Pid != 0 {
+			pid = fmt.Sprint(service.Pid)
+		}
+
+		if !service.Since.IsZero() {
+			since = service.Since.Format("15:04:05")
+		}
+
+		if service.Resources != nil {
+			cpu = fmt.Sprintf("%.2f", service.Resources.CPU)
+			rss = formatBytes(service.Resources.RSS)
+		}
+
+		if service.Exit != nil {
+			exit = fmt.Sprint(service.Exit.Code)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			service.Name, stateName(service.State), pid, since, service.Restarts, cpu, rss, exit, service.Error)
+	}
+
+	tw.Flush()
+}
+
+func (c *cli) analyze(args []string) int {
+	flags := c.flagSet("analyze", "")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	dir, err := c.runDir()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	_, err = dir.pid()
+	if err != nil && err != ErrNotRunning {
+		return c.fail(err)
+	}
+
+	running := err == nil
+
+	status, err := c.liveStatus(dir, running)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(c.stderr, ErrNotRunning)
+		return exitNotRunning
+	}
+
+	if err != nil {
+		return c.fail(err)
+	}
+
+	report := AnalyzeStartup(status)
+
+	if *asJSON {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(report); err != nil {
+			return c.fail(err)
+		}
+	} else {
+		printStartup(c.stdout, report)
+	}
+
+	if !running {
+		fmt.Fprintln(c.stderr, ErrNotRunning)
+		return exitNotRunning
+	}
+
+	return exitOK
+}
+
+// printStartup prints the report like systemd-analyze blame and critical-chain
+func printStartup(w io.Writer, report StartupReport) {
+	if len(report.CriticalPath) == 0 {
+		fmt.Fprintln(w, "No services reached the running state")
+		return
+	}
+
+	fmt.Fprintf(w, "Startup finished in %s\n\nBlame:\n", formatMilliseconds(report.Total))
+
+	for _, entry := range report.Blame {
+		fmt.Fprintf(w, "%10s  %s\n", formatMilliseconds(entry.Activation), entry.Name)
+	}
+
+	fmt.Fprintln(w, "\nCritical path:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tSCHEDULED\tWAIT\tACTIVATION\tRUNNING")
+
+	for _, entry := range report.CriticalPath {
+		fmt.Fprintf(tw, "%s\t@%s\t+%s\t+%s\t@%s\n", entry.Name, formatMilliseconds(entry.Scheduled),
+			formatMilliseconds(entry.Wait), formatMilliseconds(entry.Activation), formatMilliseconds(entry.Running))
+	}
+
+	tw.Flush()
+}
+
+// formatMilliseconds formats the duration rounded to milliseconds
+func formatMilliseconds(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+func (c *cli) logs(args []string) int {
+	flags := c.flagSet("logs", "[service]")
+	follow := flags.Bool("f", false, "follow the log")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	dir, err := c.runDir()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	name := CombinedLogName
+	if flags.NArg() == 1 {
+		if name, err = serviceLogName(flags.Arg(0)); err != nil {
+			return c.fail(err)
+		}
+	}
+
+	path := filepath.Join(dir.logsPath(), name)
+
+	if !*follow {
+		file, err := os.Open(path)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(c.stdout, file); err != nil {
+			return c.fail(err)
+		}
+
+		return exitOK
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := followFile(path, c.stdout, signals); err != nil {
+		return c.fail(err)
+	}
+
+	return exitOK
+}
+
+// followFile copies the file and its new lines until done is received.
+// The file is opened again when it is rotated
+func followFile(path string, w io.Writer, done <-chan os.Signal) error {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	var (
+		file *os.File
+		info os.FileInfo
+	)
+
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for {
+		if file == nil {
+			opened, err := os.Open(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if err == nil {
+				file = opened
+				info, _ = file.Stat()
+			}
+		}
+
+		if file != nil {
+			if _, err := io.Copy(w, file); err != nil {
+				return err
+			}
+
+			// the file was rotated
+			if current, err := os.Stat(path); err != nil || info == nil || !os.SameFile(info, current) {
+				file.Close()
+				file = nil
+			}
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *cli) graph(args []string) int {
+	flags := c.flagSet("graph", "")
+	format := flags.String("format", "text", "output format: text, dot or mermaid")
+	withState := flags.Bool("state", false, "print services of the running stack colored by their states")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	write, ok := graphWriters[*format]
+	if !ok {
+		fmt.Fprintf(c.stderr, "unknown format %q\n", *format)
+		return exitUsage
+	}
+
+	if !*withState {
+		config, err := c.loadConfig()
+		if err != nil {
+			return c.fail(err)
+		}
+
+		if err := write(c.stdout, config.Graph()); err != nil {
+			return c.fail(err)
+		}
+
+		return exitOK
+	}
+
+	dir, err := c.runDir()
+	if err != nil {
+		return c.fail(err)
+	}
+
+	_, err = dir.pid()
+	if err != nil && err != ErrNotRunning {
+		return c.fail(err)
+	}
+
+	running := err == nil
+
+	status, err := c.liveStatus(dir, running)
+	if os.IsNotExist(err) {
+		fmt.Fprintln(c.stderr, ErrNotRunning)
+		return exitNotRunning
+	}
+
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if err := write(c.stdout, GraphFromStatus(status)); err != nil {
+		return c.fail(err)
+	}
+
+	if !running {
+		fmt.Fprintln(c.stderr, ErrNotRunning)
+		return exitNotRunning
+	}
+
+	return exitOK
+}
+
+// graphWriters by the format of the graph command
+var graphWriters = map[string]func(io.Writer, Graph) error{
+	"text":    WriteText,
+	"dot":     WriteDOT,
+	"mermaid": WriteMermaid,
+}
+
+func (c *cli) check(args []string) int {
+	flags := c.flagSet("check", "")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	config, err := c.loadConfig()
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return exitFailure
+	}
+
+	fmt.Fprintf(c.stdout, "%s: %d services\n", c.configPath, len(config.Services))
+
+	return exitOK
+}
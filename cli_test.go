@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStackConfig = `
+services:
+  a:
+    command: service
+    args: [lines, "hello,ready"]
+    running: ready
+  b:
+    command: service
+    args: [lines, broken, error]
+    requires: [a]
+`
+
+func writeStackConfig(t *testing.T, config string) (string, func()) {
+	dir, err := ioutil.TempDir("", "stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, DefaultConfigFile)
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func runTestCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := runCLI(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLIUsage(t *testing.T) {
+	testCases := map[string]struct {
+		args []string
+		code int
+	}{
+		"no command": {
+			args: []string{},
+			code: exitUsage,
+		},
+		"unknown command": {
+			args: []string{"deploy"},
+			code: exitUsage,
+		},
+		"unknown flag": {
+			args: []string{"status", "-x"},
+			code: exitUsage,
+		},
+		"no config": {
+			args: []string{"-f", "missing.yml", "check"},
+			code: exitFailure,
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			code, _, _ := runTestCLI(tc.args...)
+			assert.Equal(t, tc.code, code)
+		})
+	}
+}
+
+func TestCLICheckAndGraph(t *testing.T) {
+	path, cleanup := writeStackConfig(t, testStackConfig)
+	defer cleanup()
+
+	code, stdout, _ := runTestCLI("-f", path, "check")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, path+": 2 services\n", stdout)
+
+	code, stdout, _ = runTestCLI("-f", path, "graph")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "a\nb -> a\n", stdout)
+
+	code, stdout, _ = runTestCLI("-f", path, "graph", "-format", "dot")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "\t\"b\" -> \"a\";\n")
+
+	code, _, _ = runTestCLI("-f", path, "graph", "-format", "png")
+	assert.Equal(t, exitUsage, code)
+
+	invalid, cleanup := writeStackConfig(t, "services:\n  a:\n    requires: [b]\n")
+	defer cleanup()
+
+	code, _, stderr := runTestCLI("-f", invalid, "check")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "service a: no command\nservice a: unknown requirement b")
+}
+
+func TestCLIUp(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	path, cleanup := writeStackConfig(t, testStackConfig)
+	defer cleanup()
+
+	code, _, stderr := runTestCLI("-f", path, "status")
+	assert.Equal(t, exitNotRunning, code)
+	assert.Equal(t, "stack is not running\n", stderr)
+
+	code, _, _ = runTestCLI("-f", path, "down")
+	assert.Equal(t, exitNotRunning, code)
+
+	// b fails, the stack exits when all services exited
+	code, stdout, _ := runTestCLI("-f", path, "up", "-no-color")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stdout, "a | hello\n")
+	assert.Contains(t, stdout, "b | --> failed (exit code 10): exit status 10\n")
+
+	code, stdout, _ = runTestCLI("-f", path, "status")
+	assert.Equal(t, exitNotRunning, code)
+
+	lines := strings.Split(stdout, "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Regexp(t, "^a +finished ", lines[1])
+		assert.Regexp(t, "^b +failed .* 10 +exit status 10$", lines[2])
+	}
+
+	code, stdout, _ = runTestCLI("-f", path, "graph", "-state")
+	assert.Equal(t, exitNotRunning, code)
+	assert.Equal(t, "a (finished)\nb (failed) -> a\n", stdout)
+
+	code, stdout, _ = runTestCLI("-f", path, "analyze")
+	assert.Equal(t, exitNotRunning, code)
+	assert.Contains(t, stdout, "Startup finished in ")
+	assert.Regexp(t, "Critical path:\nNAME .*\na +@0s .*\nb +@", stdout)
+
+	code, stdout, _ = runTestCLI("-f", path, "logs", "b")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, " broken\n")
+
+	code, stdout, _ = runTestCLI("-f", path, "logs")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, " a | hello\n")
+	assert.Contains(t, stdout, " b | broken\n")
+
+	code, _, stderr = runTestCLI("-f", path, "logs", "combined")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "combined.log is the combined log")
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultConfigFile is the stack config used by the command line tool
+const DefaultConfigFile = "services.yml"
+
+// StackConfig describes services of the stack, see LoadConfig
+type StackConfig struct {
+	// RunDir keeps the pid file, the state file and logs, relative to the config file
+	RunDir string `yaml:"run_dir"`
+	// MaxStarting see ServiceManager.SetMaxStarting
+	MaxStarting int `yaml:"max_starting"`
+	// GroupMaxStarting see ServiceManager.SetGroupMaxStarting
+	GroupMaxStarting map[string]int `yaml:"group_max_starting"`
+	// TailSize see ServiceManager.SetTailSize, DefaultTailSize is used if it is not set
+	TailSize *int `yaml:"tail_size"`
+	// ResourceSampling see ServiceManager.SetResourceSampling, sampling is disabled if it is zero
+	ResourceSampling time.Duration `yaml:"resource_sampling"`
+	// CgroupRoot see ServiceManager.SetCgroupRoot
+	CgroupRoot string                   `yaml:"cgroup_root"`
+	Logs       LogConfig                `yaml:"logs"`
+	HTTP       HTTPConfig               `yaml:"http"`
+	Metrics    MetricsConfig            `yaml:"metrics"`
+	Services   map[string]ServiceConfig `yaml:"services"`
+
+	// directory of the config file
+	dir string
+}
+
+// LogConfig is rotation of log files, see LogRotation
+type LogConfig struct {
+	MaxSize    int64         `yaml:"max_size"`
+	MaxAge     time.Duration `yaml:"max_age"`
+	MaxBackups int           `yaml:"max_backups"`
+	Retention  time.Duration `yaml:"retention"`
+	Compress   bool          `yaml:"compress"`
+}
+
+// HTTPConfig enables HTTPAPI
+type HTTPConfig struct {
+	// Address to listen, the host is localhost if it is omitted, the API is disabled if it is empty
+	Address string `yaml:"address"`
+	// Token required by the API, see HTTPAPI
+	Token string `yaml:"token"`
+}
+
+// MetricsConfig enables Metrics
+type MetricsConfig struct {
+	// Address to listen, the host is localhost if it is omitted, metrics are disabled if it is empty
+	Address string `yaml:"address"`
+}
+
+// ServiceConfig describes the service, the fields match Service fields
+type ServiceConfig struct {
+	Command  string   `yaml:"command"`
+	Args     []string `yaml:"args"`
+	Env      []string `yaml:"env"`
+	Requires []string `yaml:"requires"`
+	// Running is the running regexp, the service is running after start if it is empty
+	Running          string                 `yaml:"running"`
+	RunningField     string                 `yaml:"running_field"`
+	Failure          string                 `yaml:"failure"`
+	FailurePatterns  []FailurePatternConfig `yaml:"failure_patterns"`
+	SuccessExitCodes []int                  `yaml:"success_exit_codes"`
+	// Propagation is one of none, stop and restart
+	Propagation string `yaml:"propagation"`
+	Group       string `yaml:"group"`
+	Priority    int    `yaml:"priority"`
+	// LogFormat is one of none, json and logfmt
+	LogFormat      string `yaml:"log_format"`
+	MaxLineLength  int    `yaml:"max_line_length"`
+	SplitLongLines bool   `yaml:"split_long_lines"`
+	// Replicas is the number of instances of the template started by up
+	Replicas int `yaml:"replicas"`
+	// MinReady see ServiceManager.SetMinReady
+	MinReady int `yaml:"min_ready"`
+	// ResourceWarnings see Service.ResourceThresholds
+	ResourceWarnings ResourceWarningsConfig `yaml:"resource_warnings"`
+	// Limits see Service.Limits
+	Limits LimitsConfig `yaml:"limits"`
+}
+
+// LimitsConfig is ResourceLimits of the service
+type LimitsConfig struct {
+	// Memory is in bytes
+	Memory uint64 `yaml:"memory"`
+	// CPU is the number of cores
+	CPU       float64 `yaml:"cpu"`
+	OpenFiles uint64  `yaml:"open_files"`
+	Processes uint64  `yaml:"processes"`
+}
+
+// ResourceWarningsConfig is ResourceThresholds of the service
+type ResourceWarningsConfig struct {
+	// CPU is the number of cores
+	CPU float64 `yaml:"cpu"`
+	// RSS is the resident memory in bytes
+	RSS     uint64 `yaml:"rss"`
+	FDs     int    `yaml:"fds"`
+	Threads int    `yaml:"threads"`
+}
+
+type FailurePatternConfig struct {
+	Regexp string `yaml:"regexp"`
+	// Severity is one of fatal and warning
+	Severity string `yaml:"severity"`
+	Field    string `yaml:"field"`
+}
+
+var (
+	propagationNames = map[string]Propagation{
+		"":        PropagationNone,
+		"none":    PropagationNone,
+		"stop":    PropagationStop,
+		"restart": PropagationRestart,
+	}
+	logFormatNames = map[string]LogFormat{
+		"":       LogFormatNone,
+		"none":   LogFormatNone,
+		"json":   LogFormatJSON,
+		"logfmt": LogFormatLogfmt,
+	}
+	severityNames = map[string]Severity{
+		"":        SeverityFatal,
+		"fatal":   SeverityFatal,
+		"warning": SeverityWarning,
+	}
+)
+
+// ConfigErrors are all problems found by StackConfig.Check
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// LoadConfig reads and checks the stack config
+func LoadConfig(path string) (*StackConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	config.dir = filepath.Dir(path)
+
+	return config, nil
+}
+
+// ParseConfig parses and checks the stack config
+func ParseConfig(data []byte) (*StackConfig, error) {
+	config := &StackConfig{}
+
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// RunPath returns the run directory
+func (c *StackConfig) RunPath() string {
+	dir := c.RunDir
+	if dir == "" {
+		dir = ".services"
+	}
+
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return filepath.Join(c.dir, dir)
+}
+
+// Names returns names of services sorted by name
+func (c *StackConfig) Names() []string {
+	names := make([]string, 0, len(c.Services))
+
+	for name := range c.Services {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Requirements returns the requirements graph where instances are replaced with their templates
+func (c *StackConfig) Requirements() map[string][]string {
+	requirements := make(map[string][]string, len(c.Services))
+
+	for name, service := range c.Services {
+		requires := []string{}
+
+		for _, requirement := range service.Requires {
+			if template, instance := splitInstanceName(requirement); instance != "" {
+				requirement = template
+			}
+
+			requires = append(requires, requirement)
+		}
+
+		requirements[name] = deduplicateOrder(requires)
+	}
+
+	return requirements
+}
+
+// Graph returns the graph of configured services without states, instances are replaced with their templates
+func (c *StackConfig) Graph() Graph {
+	return Graph{Requirements: c.Requirements()}
+}
+
+// Check returns ConfigErrors with all problems of the config
+func (c *StackConfig) Check() error {
+	var errs ConfigErrors
+
+	if len(c.Services) == 0 {
+		errs = append(errs, fmt.Errorf("no services"))
+	}
+
+	for _, name := range c.Names() {
+		for _, err := range c.checkService(name, c.Services[name]) {
+			errs = append(errs, fmt.Errorf("service %s: %v", name, err))
+		}
+	}
+
+	if len(errs) == 0 && !IsRequirementsAcyclic(c.Requirements()) {
+		errs = append(errs, fmt.Errorf("requirements have a cycle"))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func (c *StackConfig) checkService(name string, service ServiceConfig) []error {
+	var errs []error
+
+	if service.Command == "" {
+		errs = append(errs, fmt.Errorf("no command"))
+	}
+
+	if template, _ := splitInstanceName(name); template != "" && template != name {
+		errs = append(errs, fmt.Errorf("name of the template should end with @"))
+	}
+
+	if name+".log" == CombinedLogName {
+		errs = append(errs, fmt.Errorf("name is reserved for the combined log"))
+	}
+
+	if (service.Replicas != 0 || service.MinReady != 0) && !isTemplateName(name) {
+		errs = append(errs, fmt.Errorf("replicas and min_ready are allowed only for templates"))
+	}
+
+	if service.Replicas < 0 || service.MinReady < 0 {
+		errs = append(errs, fmt.Errorf("replicas and min_ready should not be negative"))
+	}
+
+	for _, requirement := range service.Requires {
+		if !c.exists(requirement) {
+			errs = append(errs, fmt.Errorf("unknown requirement %s", requirement))
+		}
+	}
+
+	for _, expr := range []string{service.Running, service.Failure} {
+		if _, err := regexp.Compile(expr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, pattern := range service.FailurePatterns {
+		if _, err := regexp.Compile(pattern.Regexp); err != nil {
+			errs = append(errs, err)
+		}
+
+		if _, ok := severityNames[pattern.Severity]; !ok {
+			errs = append(errs, fmt.Errorf("unknown severity %s", pattern.Severity))
+		}
+	}
+
+	if _, ok := propagationNames[service.Propagation]; !ok {
+		errs = append(errs, fmt.Errorf("unknown propagation %s", service.Propagation))
+	}
+
+	if _, ok := logFormatNames[service.LogFormat]; !ok {
+		errs = append(errs, fmt.Errorf("unknown log format %s", service.LogFormat))
+	}
+
+	return errs
+}
+
+// exists checks that the service or the template of the instance is configured
+func (c *StackConfig) exists(name string) bool {
+	if _, ok := c.Services[name]; ok {
+		return true
+	}
+
+	template, instance := splitInstanceName(name)
+	_, ok := c.Services[template]
+
+	return ok && instance != ""
+}
+
+// Rotation returns rotation of log files
+func (c *StackConfig) Rotation() LogRotation {
+	return LogRotation{
+		MaxSize:    c.Logs.MaxSize,
+		MaxAge:     c.Logs.MaxAge,
+		MaxBackups: c.Logs.MaxBackups,
+		Retention:  c.Logs.Retention,
+		Compress:   c.Logs.Compress,
+	}
+}
+
+// Register registers all services of the checked config in the manager
+func (c *StackConfig) Register(sm *ServiceManager) {
+	sm.SetMaxStarting(c.MaxStarting)
+
+	for group, limit := range c.GroupMaxStarting {
+		sm.SetGroupMaxStarting(group, limit)
+	}
+
+	if c.TailSize != nil {
+		sm.SetTailSize(*c.TailSize)
+	}
+
+	sm.SetResourceSampling(c.ResourceSampling)
+	sm.SetCgroupRoot(c.CgroupRoot)
+
+	for _, name := range c.Names() {
+		config := c.Services[name]
+
+		var running *regexp.Regexp
+		if config.Running != "" {
+			running = regexp.MustCompile(config.Running)
+		}
+
+		requires := config.Requires
+		if requires == nil {
+			requires = []string{}
+		}
+
+		service := sm.Register(name, config.Command, config.Args, running, requires)
+		service.Env = config.Env
+		service.Propagation = propagationNames[config.Propagation]
+		service.Group = config.Group
+		service.Priority = config.Priority
+		service.SuccessExitCodes = config.SuccessExitCodes
+		service.MaxLineLength = config.MaxLineLength
+		service.SplitLongLines = config.SplitLongLines
+		service.LogFormat = logFormatNames[config.LogFormat]
+		service.RunningField = config.RunningField
+		service.ResourceThresholds = ResourceThresholds{
+			CPU:     config.ResourceWarnings.CPU,
+			RSS:     config.ResourceWarnings.RSS,
+			FDs:     config.ResourceWarnings.FDs,
+			Threads: config.ResourceWarnings.Threads,
+		}
+		service.Limits = ResourceLimits{
+			Memory:    config.Limits.Memory,
+			CPU:       config.Limits.CPU,
+			OpenFiles: config.Limits.OpenFiles,
+			Processes: config.Limits.Processes,
+		}
+
+		if config.Failure != "" {
+			service.FailureRegexp = regexp.MustCompile(config.Failure)
+		}
+
+		for _, pattern := range config.FailurePatterns {
+			service.FailurePatterns = append(service.FailurePatterns, FailurePattern{
+				Regexp:   regexp.MustCompile(pattern.Regexp),
+				Severity: severityNames[pattern.Severity],
+				Field:    pattern.Field,
+			})
+		}
+
+		if config.MinReady != 0 {
+			if err := sm.SetMinReady(name, config.MinReady); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := map[string]struct {
+		config string
+		err    string
+	}{
+		"valid": {
+			config: `
+services:
+  db:
+    command: postgres
+    running: ready
+  worker@:
+    command: worker
+    args: [--queue, "%i"]
+    requires: [db]
+    replicas: 2
+  api:
+    command: api
+    requires: [db, worker@1]
+    propagation: restart
+    log_format: json
+    failure_patterns:
+      - regexp: ^error$
+        field: level
+`,
+		},
+		"empty": {
+			config: ``,
+			err:    "no services",
+		},
+		"unknown field": {
+			config: `
+services:
+  db:
+    command: postgres
+    unknown: true
+`,
+			err: "field unknown not found",
+		},
+		"no command": {
+			config: `
+services:
+  db: {}
+`,
+			err: "service db: no command",
+		},
+		"unknown requirement": {
+			config: `
+services:
+  api:
+    command: api
+    requires: [db, worker@1]
+`,
+			err: "service api: unknown requirement db\nservice api: unknown requirement worker@1",
+		},
+		"invalid regexp": {
+			config: `
+services:
+  db:
+    command: postgres
+    running: "("
+`,
+			err: "service db: error parsing regexp: missing closing ): `(`",
+		},
+		"unknown values": {
+			config: `
+services:
+  db:
+    command: postgres
+    propagation: always
+    log_format: xml
+    failure_patterns:
+      - regexp: FATAL
+        severity: panic
+`,
+			err: "service db: unknown severity panic\nservice db: unknown propagation always\nservice db: unknown log format xml",
+		},
+		"replicas without template": {
+			config: `
+services:
+  db:
+    command: postgres
+    replicas: 2
+`,
+			err: "service db: replicas and min_ready are allowed only for templates",
+		},
+		"combined log name": {
+			config: `
+services:
+  combined:
+    command: combined
+`,
+			err: "service combined: name is reserved for the combined log",
+		},
+		"negative replicas": {
+			config: `
+services:
+  worker@:
+    command: worker
+    replicas: -1
+    min_ready: -1
+`,
+			err: "service worker@: replicas and min_ready should not be negative",
+		},
+		"cycle": {
+			config: `
+services:
+  a:
+    command: a
+    requires: [b]
+  b:
+    command: b
+    requires: [a]
+`,
+			err: "requirements have a cycle",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tc.config))
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestStackConfigRegister(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+max_starting: 2
+tail_size: 5
+resource_sampling: 10s
+cgroup_root: /sys/fs/cgroup/services
+logs:
+  max_age: 1h
+services:
+  db:
+    command: postgres
+    args: [-D, data]
+    env: [PGPORT=5432]
+    running: ready
+    failure: ^FATAL
+    success_exit_codes: [143]
+    group: infra
+    priority: 10
+  api:
+    command: api
+    requires: [db]
+    propagation: stop
+    log_format: logfmt
+    running_field: msg
+    resource_warnings:
+      cpu: 1.5
+      rss: 536870912
+    limits:
+      memory: 1073741824
+      open_files: 1024
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, time.Hour, config.Rotation().MaxAge)
+
+	m := NewServiceManager()
+	config.Register(m)
+
+	assert.Equal(t, 2, m.maxStarting)
+	assert.Equal(t, 5, m.tailSize)
+	assert.Equal(t, 10*time.Second, m.sampleInterval)
+	assert.Equal(t, "/sys/fs/cgroup/services", m.cgroupRoot)
+	assert.Equal(t, map[string][]string{
+		"db":  {},
+		"api": {"db"},
+	}, m.requirements)
+
+	db := m.services["db"]
+	assert.Equal(t, []string{"-D", "data"}, db.Args)
+	assert.Equal(t, []string{"PGPORT=5432"}, db.Env)
+	assert.Equal(t, regexp.MustCompile("ready"), db.runningRegexp)
+	assert.Equal(t, regexp.MustCompile("^FATAL"), db.FailureRegexp)
+	assert.Equal(t, []int{143}, db.SuccessExitCodes)
+	assert.Equal(t, "infra", db.Group)
+	assert.Equal(t, 10, db.Priority)
+
+	api := m.services["api"]
+	assert.Nil(t, api.runningRegexp)
+	assert.Equal(t, PropagationStop, api.Propagation)
+	assert.Equal(t, LogFormatLogfmt, api.LogFormat)
+	assert.Equal(t, "msg", api.RunningField)
+	assert.Equal(t, ResourceThresholds{CPU: 1.5, RSS: 512 << 20}, api.ResourceThresholds)
+	assert.Equal(t, ResourceLimits{Memory: 1 << 30, OpenFiles: 1024}, api.Limits)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+
+	consoleTimeFormat = "15:04:05.000"
+)
+
+// consoleColors are assigned to service names in turn
+var consoleColors = []string{
+	"\x1b[36m", // cyan
+	"\x1b[33m", // yellow
+	"\x1b[32m", // green
+	"\x1b[35m", // magenta
+	"\x1b[34m", // blue
+	"\x1b[96m", // bright cyan
+	"\x1b[93m", // bright yellow
+	"\x1b[92m", // bright green
+	"\x1b[95m", // bright magenta
+	"\x1b[94m", // bright blue
+}
+
+type ConsoleOptions struct {
+	// Color enables ANSI colors, see IsTerminal
+	Color bool
+	// Timestamps prefixes lines with the message time
+	Timestamps bool
+}
+
+// Console is MessageSink that prints messages like "name | line"
+// with aligned and colored service names
+type Console struct {
+	w       io.Writer
+	options ConsoleOptions
+	colors  map[string]string
+	width   int
+}
+
+// NewConsole creates Console, names are used to align prefixes and assign colors,
+// other names are added when they are printed
+func NewConsole(w io.Writer, names []string, options ConsoleOptions) *Console {
+	c := &Console{
+		w:       w,
+		options: options,
+		colors:  make(map[string]string),
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		c.add(name)
+	}
+
+	return c
+}
+
+func (c *Console) add(name string) {
+	if _, ok := c.colors[name]; ok {
+		return
+	}
+
+	c.colors[name] = consoleColors[len(c.colors)%len(consoleColors)]
+
+	if len(name) > c.width {
+		c.width = len(name)
+	}
+}
+
+// HandleMessage prints the message, write errors are ignored
+func (c *Console) HandleMessage(message ServiceMessage) {
+	c.add(message.Name)
+
+	var line string
+
+	switch message.Type {
+	case MessageState:
+		line = c.paint(colorBold+stateColor(message.State), "--> "+formatConsoleState(message))
+	case MessageWarning:
+		line = c.paint(colorYellow, message.Value)
+	default:
+		line = message.Value
+	}
+
+	_, _ = fmt.Fprintln(c.w, c.prefix(message)+line)
+}
+
+func (c *Console) prefix(message ServiceMessage) string {
+	prefix := c.paint(c.colors[message.Name], fmt.Sprintf("%-*s |", c.width, message.Name)) + " "
+
+	if c.options.Timestamps {
+		prefix = message.Time.Format(consoleTimeFormat) + " " + prefix
+	}
+
+	return prefix
+}
+
+func (c *Console) paint(color string, s string) string {
+	if !c.options.Color || color == "" {
+		return s
+	}
+
+	return color + s + colorReset
+}
+
+func stateColor(state State) string {
+	switch state {
+	case StateRunning:
+		return colorGreen
+	case StateFailed:
+		return colorRed
+	case StateStopped, StateFinished:
+		return colorYellow
+	}
+
+	return ""
+}
+
+func formatConsoleState(message ServiceMessage) string {
+	line := stateName(message.State)
+
+	if message.Exit != nil {
+		line += fmt.Sprintf(" (exit code %d)", message.Exit.Code)
+	}
+
+	if message.FailureReason == FailureReasonOOM {
+		line += " (out of memory)"
+	}
+
+	if message.Value != "" {
+		line += ": " + message.Value
+	}
+
+	return line
+}
+
+// stateName returns the short name of the state like "running"
+func stateName(state State) string {
+	return strings.ToLower(strings.TrimPrefix(state.String(), "State"))
+}
+
+// IsTerminal reports whether the file is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsole(t *testing.T) {
+	var (
+		at       = time.Date(2020, 1, 1, 10, 20, 30, 400000000, time.UTC)
+		messages = []ServiceMessage{
+			{Name: "db", Type: MessageState, State: StateRunning, Time: at},
+			{Name: "api", Type: MessageString, Value: "hello", Time: at},
+			{Name: "api", Type: MessageWarning, Value: "slow", Time: at},
+			{Name: "db", Type: MessageState, State: StateFailed, Value: "exit status 1", Exit: &ExitStatus{Code: 1}, Time: at},
+			{Name: "worker", Type: MessageString, Value: "new", Time: at},
+		}
+	)
+
+	testCases := map[string]struct {
+		options  ConsoleOptions
+		expected string
+	}{
+		"plain": {
+			expected: "" +
+				"db  | --> running\n" +
+				"api | hello\n" +
+				"api | slow\n" +
+				"db  | --> failed (exit code 1): exit status 1\n" +
+				"worker | new\n",
+		},
+		"timestamps": {
+			options: ConsoleOptions{Timestamps: true},
+			expected: "" +
+				"10:20:30.400 db  | --> running\n" +
+				"10:20:30.400 api | hello\n" +
+				"10:20:30.400 api | slow\n" +
+				"10:20:30.400 db  | --> failed (exit code 1): exit status 1\n" +
+				"10:20:30.400 worker | new\n",
+		},
+		"color": {
+			options: ConsoleOptions{Color: true},
+			expected: "" +
+				"\x1b[33mdb  |\x1b[0m \x1b[1m\x1b[32m--> running\x1b[0m\n" +
+				"\x1b[36mapi |\x1b[0m hello\n" +
+				"\x1b[36mapi |\x1b[0m \x1b[33mslow\x1b[0m\n" +
+				"\x1b[33mdb  |\x1b[0m \x1b[1m\x1b[31m--> failed (exit code 1): exit status 1\x1b[0m\n" +
+				"\x1b[32mworker |\x1b[0m new\n",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			console := NewConsole(&buf, []string{"db", "api"}, tc.options)
+			for _, message := range messages {
+				console.HandleMessage(message)
+			}
+
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+)
+
+// Commands of the control protocol
+const (
+	ControlStart     = "start"
+	ControlStop      = "stop"
+	ControlRestart   = "restart"
+	ControlStatus    = "status"
+	ControlTail      = "tail"
+	ControlSubscribe = "subscribe"
+	ControlShutdown  = "shutdown"
+)
+
+// ControlRequest is a line of the control protocol sent by the client.
+// Every request gets ControlResponse with the same ID, subscribe and tail with Follow
+// get a response for every message until the connection is closed
+type ControlRequest struct {
+	ID      int
+	Command string
+	// Names of services of start, stop, restart and subscribe.
+	// Restart without names restarts all started services, subscribe without names receives all messages
+	Names []string `json:",omitempty"`
+	// Follow streams output of the service after tail
+	Follow bool `json:",omitempty"`
+}
+
+// ControlResponse is a line of the control protocol sent by the server
+type ControlResponse struct {
+	ID     int
+	Error  string          `json:",omitempty"`
+	Status []ServiceStatus `json:",omitempty"`
+	Lines  []string        `json:",omitempty"`
+	Event  *ServiceMessage `json:",omitempty"`
+}
+
+// ControlServer serves the control protocol on the Unix socket.
+// Commands are sent to the manager like calls of its methods
+type ControlServer struct {
+	sm       *ServiceManager
+	events   *Broadcaster
+	shutdown func()
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// ListenControl listens the Unix socket, a stale socket file is removed.
+// Shutdown is called by the shutdown command, it should not wait for Close
+func ListenControl(path string, sm *ServiceManager, events *Broadcaster, shutdown func()) (*ControlServer, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use", path)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ControlServer{
+		sm:       sm,
+		events:   events,
+		shutdown: shutdown,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections until Close
+func (s *ControlServer) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close closes the socket and all connections. You should call it before ServiceManager.Close
+func (s *ControlServer) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *ControlServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+
+		conn.Close()
+	}()
+
+	var (
+		decoder = json.NewDecoder(bufio.NewReader(conn))
+		encoder = json.NewEncoder(conn)
+	)
+
+	for {
+		var request ControlRequest
+
+		if err := decoder.Decode(&request); err != nil {
+			if err != io.EOF && !isClosedError(err) {
+				_ = encoder.Encode(ControlResponse{Error: err.Error()})
+			}
+
+			return
+		}
+
+		switch request.Command {
+		case ControlSubscribe:
+			s.stream(conn, encoder, request, nil)
+			return
+		case ControlTail:
+			if err := s.checkNames(request.Names, 1); err != nil {
+				_ = encoder.Encode(ControlResponse{ID: request.ID, Error: err.Error()})
+				continue
+			}
+
+			response := ControlResponse{
+				ID:    request.ID,
+				Lines: s.sm.Tail(request.Names[0]),
+			}
+
+			if !request.Follow {
+				if err := encoder.Encode(response); err != nil {
+					return
+				}
+
+				continue
+			}
+
+			s.stream(conn, encoder, request, &response)
+
+			return
+		}
+
+		if err := encoder.Encode(s.handle(request)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *ControlServer) handle(request ControlRequest) ControlResponse {
+	response := ControlResponse{
+		ID: request.ID,
+	}
+
+	var err error
+
+	switch request.Command {
+	case ControlStart, ControlStop:
+		if err = s.checkNames(request.Names, -1); err == nil {
+			for _, name := range request.Names {
+				if request.Command == ControlStart {
+					s.sm.Start(name)
+				} else {
+					s.sm.Stop(name)
+				}
+			}
+		}
+	case ControlRestart:
+		names := request.Names
+		if len(names) == 0 {
+			restartServices(s.sm, s.sm.Status())
+		} else if err = s.checkNames(names, -1); err == nil {
+			for _, name := range names {
+				s.sm.Restart(name)
+			}
+		}
+	case ControlStatus:
+		response.Status = s.sm.Status()
+	case ControlShutdown:
+		s.shutdown()
+	default:
+		err = fmt.Errorf("unknown command %q", request.Command)
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	return response
+}
+
+// stream sends the first response and then messages until the connection is closed.
+// Tail follows only output lines
+func (s *ControlServer) stream(conn net.Conn, encoder *json.Encoder, request ControlRequest, first *ControlResponse) {
+	subscription := s.events.Subscribe(request.Names)
+	defer s.events.Unsubscribe(subscription)
+
+	if first == nil {
+		first = &ControlResponse{ID: request.ID}
+	}
+
+	if err := encoder.Encode(first); err != nil {
+		return
+	}
+
+	// the connection is closed by the client or by Close
+	closed := make(chan struct{})
+
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, conn)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case message, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+
+			if request.Command == ControlTail && message.Type != MessageString {
+				continue
+			}
+
+			event := message
+			if err := encoder.Encode(ControlResponse{ID: request.ID, Event: &event}); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// checkNames checks that services exist, n is the required number of names, -1 means at least one
+func (s *ControlServer) checkNames(names []string, n int) error {
+	if (n < 0 && len(names) == 0) || (n >= 0 && len(names) != n) {
+		return errors.New("invalid number of service names")
+	}
+
+	for _, name := range names {
+		if !s.sm.hasService(name) {
+			return fmt.Errorf("unknown service %s", name)
+		}
+	}
+
+	return nil
+}
+
+func isClosedError(err error) bool {
+	var netErr *net.OpError
+
+	return errors.As(err, &netErr)
+}
+
+// ControlClient sends requests to ControlServer
+type ControlClient struct {
+	conn    net.Conn
+	decoder *json.Decoder
+	encoder *json.Encoder
+	id      int
+}
+
+func DialControl(path string) (*ControlClient, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ControlClient{
+		conn:    conn,
+		decoder: json.NewDecoder(bufio.NewReader(conn)),
+		encoder: json.NewEncoder(conn),
+	}, nil
+}
+
+// Call sends the request and returns the response, the response error is returned as error
+func (c *ControlClient) Call(request ControlRequest) (ControlResponse, error) {
+	c.id++
+	request.ID = c.id
+
+	if err := c.encoder.Encode(request); err != nil {
+		return ControlResponse{}, err
+	}
+
+	var response ControlResponse
+
+	if err := c.decoder.Decode(&response); err != nil {
+		return ControlResponse{}, err
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+
+	return response, nil
+}
+
+// Next reads the next response of subscribe or tail with Follow
+func (c *ControlClient) Next() (ControlResponse, error) {
+	var response ControlResponse
+
+	err := c.decoder.Decode(&response)
+
+	return response, err
+}
+
+func (c *ControlClient) Close() error {
+	return c.conn.Close()
+}
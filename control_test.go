@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlServer(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		m             = NewServiceManager()
+		events        = NewBroadcaster()
+		startTemplate = regexp.MustCompile("ready")
+		shutdown      = make(chan struct{}, 1)
+	)
+
+	m.Register("A", "service", []string{"lines", "hello,ready", "sleep", "10000"}, startTemplate, []string{})
+	m.AddSink(events)
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	go func() {
+		for range messages {
+		}
+	}()
+
+	server, err := ListenControl(filepath.Join(dir, "control.sock"), m, events, func() {
+		shutdown <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go server.Serve()
+
+	subscriber, err := DialControl(filepath.Join(dir, "control.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+
+	_, err = subscriber.Call(ControlRequest{Command: ControlSubscribe, Names: []string{"A"}})
+	assert.NoError(t, err)
+
+	client, err := DialControl(filepath.Join(dir, "control.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	_, err = client.Call(ControlRequest{Command: "deploy"})
+	assert.EqualError(t, err, `unknown command "deploy"`)
+
+	_, err = client.Call(ControlRequest{Command: ControlStart, Names: []string{"B"}})
+	assert.EqualError(t, err, "unknown service B")
+
+	_, err = client.Call(ControlRequest{Command: ControlStart, Names: []string{"A"}})
+	assert.NoError(t, err)
+
+	for {
+		response, err := subscriber.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response.Event.Type == MessageState && response.Event.State == StateRunning {
+			break
+		}
+	}
+
+	response, err := client.Call(ControlRequest{Command: ControlStatus})
+	if assert.NoError(t, err) && assert.Len(t, response.Status, 1) {
+		assert.Equal(t, StateRunning, response.Status[0].State)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.Tail("A")) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	response, err = client.Call(ControlRequest{Command: ControlTail, Names: []string{"A"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hello", "ready"}, response.Lines)
+
+	_, err = client.Call(ControlRequest{Command: ControlShutdown})
+	assert.NoError(t, err)
+
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Error("shutdown wasn't called")
+	}
+
+	assert.NoError(t, server.Close())
+	m.Close()
+
+	// the stream is closed after buffered messages
+	for i := 0; i < subscriptionBuffer; i++ {
+		if _, err = subscriber.Next(); err != nil {
+			break
+		}
+	}
+	assert.Error(t, err)
+}
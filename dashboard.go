@@ -0,0 +1,310 @@
+package main
+
+import (
+	"net/http"
+)
+
+// handleDashboard serves the web page working on top of the API:
+// the dependency graph, states of services, log tails and start/stop/restart buttons.
+// The page passes its token query parameter to the API
+func (api *HTTPAPI) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = w.Write([]byte(dashboardHTML))
+}
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>services</title>
+<style>
+body { margin: 0; font: 14px sans-serif; color: #222; display: flex; height: 100vh; }
+#side { width: 420px; overflow: auto; border-right: 1px solid #ddd; }
+#main { flex: 1; display: flex; flex-direction: column; min-width: 0; }
+#graph { height: 45%; overflow: auto; border-bottom: 1px solid #ddd; }
+#log { flex: 1; overflow: auto; margin: 0; padding: 8px; font: 12px monospace; background: #111; color: #ddd; white-space: pre-wrap; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eee; }
+tr.selected { background: #eef; }
+td.name { cursor: pointer; }
+button { font-size: 12px; }
+.state { font-weight: bold; }
+.StateDead { color: #888; } .StateStarted { color: #c90; } .StateRunning { color: #080; }
+.StateFinished { color: #06c; } .StateFailed { color: #c00; } .StateStopped { color: #555; }
+.warning { color: #fc0; }
+#error { color: #c00; padding: 4px 8px; }
+svg text { font-size: 12px; cursor: pointer; }
+</style>
+</head>
+<body>
+<div id="side">
+<div id="error"></div>
+<table>
+<thead><tr><th>service</th><th>state</th><th>pid</th><th>restarts</th><th></th></tr></thead>
+<tbody id="services"></tbody>
+</table>
+</div>
+<div id="main">
+<div id="graph"></div>
+<pre id="log"></pre>
+</div>
+<script>
+var token = new URLSearchParams(location.search).get("token") || "";
+var services = [];
+var selected = "";
+
+var colors = {
+	StateDead: "#888", StateStarted: "#c90", StateRunning: "#080",
+	StateFinished: "#06c", StateFailed: "#c00", StateStopped: "#555"
+};
+
+function url(path) {
+	if (!token) {
+		return path;
+	}
+	return path + (path.indexOf("?") < 0 ? "?" : "&") + "token=" + encodeURIComponent(token);
+}
+
+function showError(message) {
+	document.getElementById("error").textContent = message;
+}
+
+function element(tag, text, className) {
+	var e = document.createElement(tag);
+	if (text !== undefined) {
+		e.textContent = text;
+	}
+	if (className) {
+		e.className = className;
+	}
+	return e;
+}
+
+function stateName(state) {
+	return state.replace(/^State/, "").toLowerCase();
+}
+
+function load() {
+	fetch(url("/services")).then(function (response) {
+		if (!response.ok) {
+			throw new Error(response.status + " " + response.statusText);
+		}
+		return response.json();
+	}).then(function (status) {
+		services = status;
+		showError("");
+		renderTable();
+		renderGraph();
+	}).catch(function (err) {
+		showError("can not load services: " + err.message);
+	});
+}
+
+function action(name, command) {
+	fetch(url("/services/" + encodeURIComponent(name) + "/" + command), {method: "POST"}).then(function (response) {
+		if (!response.ok) {
+			return response.json().then(function (body) {
+				throw new Error(body.Error);
+			});
+		}
+	}).catch(function (err) {
+		showError(command + " " + name + ": " + err.message);
+	});
+}
+
+function renderTable() {
+	var body = document.getElementById("services");
+	body.textContent = "";
+
+	services.forEach(function (service) {
+		var row = element("tr", undefined, service.Name === selected ? "selected" : "");
+		var name = element("td", service.Name, "name");
+		name.onclick = function () { select(service.Name); };
+		row.appendChild(name);
+
+		var state = element("td", stateName(service.State), "state " + service.State);
+		if (service.Error) {
+			state.title = service.Error;
+		}
+		row.appendChild(state);
+		row.appendChild(element("td", service.Pid ? String(service.Pid) : ""));
+		row.appendChild(element("td", String(service.Restarts)));
+
+		var buttons = element("td");
+		["start", "stop", "restart"].forEach(function (command) {
+			var button = element("button", command);
+			button.onclick = function () { action(service.Name, command); };
+			buttons.appendChild(button);
+		});
+		row.appendChild(buttons);
+
+		body.appendChild(row);
+	});
+}
+
+// renderGraph places services in columns by the depth of their requirements
+function renderGraph() {
+	var known = {};
+	services.forEach(function (service) {
+		known[service.Name] = true;
+	});
+
+	var requires = {};
+	services.forEach(function (service) {
+		requires[service.Name] = (service.Requires || []).filter(function (name) {
+			return known[name];
+		});
+	});
+
+	var depths = {};
+	function depth(name, visiting) {
+		if (name in depths) {
+			return depths[name];
+		}
+		if (visiting[name]) {
+			return 0;
+		}
+		visiting[name] = true;
+		var result = 0;
+		requires[name].forEach(function (requirement) {
+			result = Math.max(result, depth(requirement, visiting) + 1);
+		});
+		depths[name] = result;
+		return result;
+	}
+
+	var columns = [];
+	services.forEach(function (service) {
+		var d = depth(service.Name, {});
+		(columns[d] = columns[d] || []).push(service.Name);
+	});
+
+	var width = 170, height = 36, positions = {}, rows = 0;
+	columns.forEach(function (column, x) {
+		column.forEach(function (name, y) {
+			positions[name] = {x: 20 + x * width, y: 20 + y * height};
+		});
+		rows = Math.max(rows, column.length);
+	});
+
+	var ns = "http://www.w3.org/2000/svg";
+	var svg = document.createElementNS(ns, "svg");
+	svg.setAttribute("width", 40 + columns.length * width);
+	svg.setAttribute("height", 40 + rows * height);
+
+	services.forEach(function (service) {
+		var from = positions[service.Name];
+		requires[service.Name].forEach(function (requirement) {
+			var to = positions[requirement];
+			var line = document.createElementNS(ns, "line");
+			line.setAttribute("x1", from.x);
+			line.setAttribute("y1", from.y + 10);
+			line.setAttribute("x2", to.x + 130);
+			line.setAttribute("y2", to.y + 10);
+			line.setAttribute("stroke", "#bbb");
+			svg.appendChild(line);
+		});
+	});
+
+	services.forEach(function (service) {
+		var position = positions[service.Name];
+		var group = document.createElementNS(ns, "g");
+		group.onclick = function () { select(service.Name); };
+
+		var rect = document.createElementNS(ns, "rect");
+		rect.setAttribute("x", position.x);
+		rect.setAttribute("y", position.y);
+		rect.setAttribute("width", 130);
+		rect.setAttribute("height", 20);
+		rect.setAttribute("rx", 4);
+		rect.setAttribute("fill", "#fff");
+		rect.setAttribute("stroke", colors[service.State] || "#888");
+		rect.setAttribute("stroke-width", service.Name === selected ? 3 : 1.5);
+		group.appendChild(rect);
+
+		var text = document.createElementNS(ns, "text");
+		text.setAttribute("x", position.x + 6);
+		text.setAttribute("y", position.y + 14);
+		text.setAttribute("fill", colors[service.State] || "#888");
+		text.textContent = service.Name;
+		group.appendChild(text);
+
+		svg.appendChild(group);
+	});
+
+	var graph = document.getElementById("graph");
+	graph.textContent = "";
+	graph.appendChild(svg);
+}
+
+function appendLog(text, className) {
+	var log = document.getElementById("log");
+	var bottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+	log.appendChild(element("span", text + "\n", className));
+	if (bottom) {
+		log.scrollTop = log.scrollHeight;
+	}
+}
+
+function select(name) {
+	selected = name;
+	renderTable();
+	renderGraph();
+
+	var log = document.getElementById("log");
+	log.textContent = "";
+
+	fetch(url("/services/" + encodeURIComponent(name) + "/tail")).then(function (response) {
+		return response.json();
+	}).then(function (lines) {
+		if (selected === name) {
+			(lines || []).forEach(function (line) { appendLog(line); });
+		}
+	}).catch(function (err) {
+		showError("can not load the tail of " + name + ": " + err.message);
+	});
+}
+
+var events = new EventSource(url("/events"));
+events.addEventListener("state", function (event) {
+	var message = JSON.parse(event.data);
+	if (message.Name === selected) {
+		appendLog("--> " + stateName(message.State) + (message.Value ? ": " + message.Value : ""), "state " + message.State);
+	}
+	load();
+});
+events.addEventListener("string", function (event) {
+	var message = JSON.parse(event.data);
+	if (message.Name === selected) {
+		appendLog(message.Value);
+	}
+});
+events.addEventListener("warning", function (event) {
+	var message = JSON.parse(event.data);
+	if (message.Name === selected) {
+		appendLog(message.Value, "warning");
+	}
+});
+events.onopen = load;
+events.onerror = function () {
+	showError("the event stream is disconnected, reconnecting");
+};
+
+load();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+)
+
+// subscriptionBuffer is the number of messages a subscriber can be behind
+const subscriptionBuffer = 256
+
+// Broadcaster is MessageSink that sends messages to subscribers.
+// A subscriber that does not keep up is unsubscribed, so it never blocks the manager
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives messages of the services, see Broadcaster.Subscribe
+type Subscription struct {
+	// C is closed after Unsubscribe or when the subscriber is too slow
+	C <-chan ServiceMessage
+
+	c     chan ServiceMessage
+	names map[string]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe subscribes to messages of the services, all services if names are empty.
+// Messages of instances are received by the template name too
+func (b *Broadcaster) Subscribe(names []string) *Subscription {
+	c := make(chan ServiceMessage, subscriptionBuffer)
+	s := &Subscription{
+		C: c,
+		c: c,
+	}
+
+	if len(names) > 0 {
+		s.names = make(map[string]struct{}, len(names))
+
+		for _, name := range names {
+			s.names[name] = struct{}{}
+		}
+	}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+}
+
+// Unsubscribe closes the subscription, it can be called several times
+func (b *Broadcaster) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+// HandleMessage sends the message to subscribers
+func (b *Broadcaster) HandleMessage(message ServiceMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if !s.match(message.Name) {
+			continue
+		}
+
+		select {
+		case s.c <- message:
+		default:
+			delete(b.subscribers, s)
+			close(s.c)
+		}
+	}
+}
+
+// Close closes all subscriptions
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+func (s *Subscription) match(name string) bool {
+	if s.names == nil {
+		return true
+	}
+
+	if _, ok := s.names[name]; ok {
+		return true
+	}
+
+	template, _ := splitInstanceName(name)
+	_, ok := s.names[template]
+
+	return ok && template != name
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcaster(t *testing.T) {
+	var (
+		b        = NewBroadcaster()
+		all      = b.Subscribe(nil)
+		workers  = b.Subscribe([]string{"worker@"})
+		db       = b.Subscribe([]string{"db"})
+		received = func(s *Subscription) []string {
+			var names []string
+
+			for {
+				select {
+				case message, ok := <-s.C:
+					if !ok {
+						return names
+					}
+
+					names = append(names, message.Name)
+				default:
+					return names
+				}
+			}
+		}
+	)
+
+	for _, name := range []string{"db", "worker@1", "api", "worker@"} {
+		b.HandleMessage(ServiceMessage{Name: name})
+	}
+
+	assert.Equal(t, []string{"db", "worker@1", "api", "worker@"}, received(all))
+	assert.Equal(t, []string{"worker@1", "worker@"}, received(workers))
+	assert.Equal(t, []string{"db"}, received(db))
+
+	b.Unsubscribe(db)
+	b.Unsubscribe(db)
+
+	_, ok := <-db.C
+	assert.False(t, ok)
+
+	// slow subscriber is unsubscribed
+	for i := 0; i <= subscriptionBuffer; i++ {
+		b.HandleMessage(ServiceMessage{Name: "api"})
+	}
+
+	assert.Len(t, received(all), subscriptionBuffer)
+
+	_, ok = <-all.C
+	assert.False(t, ok)
+
+	b.Close()
+
+	_, ok = <-workers.C
+	assert.False(t, ok)
+}
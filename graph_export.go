@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// stateColors are fill colors of nodes by state in exported graphs
+var stateColors = map[State]string{
+	StateDead:     "#e0e0e0",
+	StateStarted:  "#ffe08a",
+	StateRunning:  "#a6e3a1",
+	StateFinished: "#89b4fa",
+	StateFailed:   "#f38ba8",
+	StateStopped:  "#bdbdbd",
+}
+
+// Graph is the requirements graph of services for export, see WriteDOT and WriteMermaid
+type Graph struct {
+	// Requirements by service name, an edge goes from the service to its requirement
+	Requirements map[string][]string
+	// States color nodes, nodes are not colored if it is nil
+	States map[string]State
+}
+
+// Graph returns registered services with their requirements and current states.
+// It is safe to call it from any goroutine
+func (sm *ServiceManager) Graph() Graph {
+	return GraphFromStatus(sm.Status())
+}
+
+// GraphFromStatus returns the graph of services of the status with their states
+func GraphFromStatus(status []ServiceStatus) Graph {
+	graph := Graph{
+		Requirements: make(map[string][]string, len(status)),
+		States:       make(map[string]State, len(status)),
+	}
+
+	for _, service := range status {
+		graph.Requirements[service.Name] = service.Requires
+		graph.States[service.Name] = service.State
+	}
+
+	return graph
+}
+
+// Nodes returns sorted names of services and their requirements
+func (g Graph) Nodes() []string {
+	nodes := make(map[string]struct{}, len(g.Requirements))
+
+	for name, requirements := range g.Requirements {
+		nodes[name] = struct{}{}
+
+		for _, requirement := range requirements {
+			nodes[requirement] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// state returns the state of the node, false if nodes are not colored or the state is unknown
+func (g Graph) state(name string) (State, bool) {
+	if g.States == nil {
+		return StateDead, false
+	}
+
+	state, ok := g.States[name]
+
+	return state, ok
+}
+
+// WriteText writes lines like "name (state) -> requirement, requirement"
+func WriteText(w io.Writer, graph Graph) error {
+	var b strings.Builder
+
+	for _, name := range graph.Nodes() {
+		b.WriteString(name)
+
+		if state, ok := graph.state(name); ok {
+			b.WriteString(" (" + stateName(state) + ")")
+		}
+
+		if requirements := graph.Requirements[name]; len(requirements) > 0 {
+			b.WriteString(" -> " + strings.Join(requirements, ", "))
+		}
+
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language
+func WriteDOT(w io.Writer, graph Graph) error {
+	var b strings.Builder
+
+	b.WriteString("digraph services {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\"];\n")
+
+	for _, name := range graph.Nodes() {
+		if state, ok := graph.state(name); ok {
+			fmt.Fprintf(&b, "\t%s [fillcolor=%s, tooltip=%s];\n",
+				quoteDOT(name), quoteDOT(stateColors[state]), quoteDOT(stateName(state)))
+		} else {
+			fmt.Fprintf(&b, "\t%s;\n", quoteDOT(name))
+		}
+	}
+
+	for _, name := range graph.Nodes() {
+		for _, requirement := range graph.Requirements[name] {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", quoteDOT(name), quoteDOT(requirement))
+		}
+	}
+
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart. Nodes get ids like n0 because names
+// of instances are not valid ids, states are classes of nodes
+func WriteMermaid(w io.Writer, graph Graph) error {
+	var (
+		b       strings.Builder
+		nodes   = graph.Nodes()
+		ids     = make(map[string]string, len(nodes))
+		classes = make(map[State][]string)
+	)
+
+	b.WriteString("graph LR\n")
+
+	for i, name := range nodes {
+		ids[name] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", ids[name], strings.ReplaceAll(name, `"`, "#quot;"))
+
+		if state, ok := graph.state(name); ok {
+			classes[state] = append(classes[state], ids[name])
+		}
+	}
+
+	for _, name := range nodes {
+		for _, requirement := range graph.Requirements[name] {
+			fmt.Fprintf(&b, "\t%s --> %s\n", ids[name], ids[requirement])
+		}
+	}
+
+	for _, state := range StateValues() {
+		if len(classes[state]) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\tclassDef %s fill:%s,stroke:#333\n", stateName(state), stateColors[state])
+		fmt.Fprintf(&b, "\tclass %s %s\n", strings.Join(classes[state], ","), stateName(state))
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// quoteDOT quotes the DOT identifier
+func quoteDOT(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphExport(t *testing.T) {
+	graph := GraphFromStatus([]ServiceStatus{
+		{Name: "api", State: StateRunning, Requires: []string{"db", "cache"}},
+		{Name: "db", State: StateRunning},
+		{Name: `w"1`, State: StateFailed, Requires: []string{"api"}},
+	})
+
+	var b strings.Builder
+
+	assert.NoError(t, WriteText(&b, graph))
+	assert.Equal(t, "api (running) -> db, cache\ncache\ndb (running)\nw\"1 (failed) -> api\n", b.String())
+
+	b.Reset()
+	assert.NoError(t, WriteDOT(&b, graph))
+	assert.Equal(t, `digraph services {
+	rankdir=LR;
+	node [shape=box, style="rounded,filled", fillcolor="#ffffff"];
+	"api" [fillcolor="#a6e3a1", tooltip="running"];
+	"cache";
+	"db" [fillcolor="#a6e3a1", tooltip="running"];
+	"w\"1" [fillcolor="#f38ba8", tooltip="failed"];
+	"api" -> "db";
+	"api" -> "cache";
+	"w\"1" -> "api";
+}
+`, b.String())
+
+	b.Reset()
+	assert.NoError(t, WriteMermaid(&b, graph))
+	assert.Equal(t, `graph LR
+	n0["api"]
+	n1["cache"]
+	n2["db"]
+	n3["w#quot;1"]
+	n0 --> n2
+	n0 --> n1
+	n3 --> n0
+	classDef running fill:#a6e3a1,stroke:#333
+	class n0,n2 running
+	classDef failed fill:#f38ba8,stroke:#333
+	class n3 failed
+`, b.String())
+
+	// nodes are not colored without states
+	graph.States = nil
+
+	b.Reset()
+	assert.NoError(t, WriteMermaid(&b, graph))
+	assert.NotContains(t, b.String(), "class")
+}
+
+func TestStackConfigGraph(t *testing.T) {
+	config := &StackConfig{
+		Services: map[string]ServiceConfig{
+			"api":     {Requires: []string{"db@1", "db@2"}},
+			"db@":     {},
+			"migrate": {Requires: []string{"db@1"}},
+		},
+	}
+
+	var b strings.Builder
+
+	assert.NoError(t, WriteText(&b, config.Graph()))
+	assert.Equal(t, "api -> db@\ndb@\nmigrate -> db@\n", b.String())
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sseKeepAlive is the interval of comments sent to keep event streams open
+const sseKeepAlive = 15 * time.Second
+
+// messageTypeNames are names of message types in event streams
+var messageTypeNames = map[string]MessageType{
+	"state":   MessageState,
+	"string":  MessageString,
+	"warning": MessageWarning,
+}
+
+// HTTPAPI serves services as REST resources:
+//
+//	GET  /                                the web dashboard
+//	GET  /services                        statuses of all services
+//	GET  /services/{name}                 status of the service
+//	GET  /services/{name}/tail            last output lines of the service
+//	POST /services/{name}/start|stop|restart
+//	GET  /events?service=name&type=state  Server-Sent Events with messages
+//
+// If the token is set, requests should have the "Authorization: Bearer <token>" header
+// or the token query parameter. Without the token the host of requests should be localhost or an IP address
+// to prevent DNS rebinding. POST requests of browsers are accepted only from the same origin
+type HTTPAPI struct {
+	sm     *ServiceManager
+	events *Broadcaster
+	token  string
+	mux    *http.ServeMux
+
+	// closed by Close to finish event streams
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewHTTPAPI(sm *ServiceManager, events *Broadcaster, token string) *HTTPAPI {
+	api := &HTTPAPI{
+		sm:     sm,
+		events: events,
+		token:  token,
+		mux:    http.NewServeMux(),
+		done:   make(chan struct{}),
+	}
+
+	api.mux.HandleFunc("/services", api.handleServices)
+	api.mux.HandleFunc("/services/", api.handleService)
+	api.mux.HandleFunc("/events", api.handleEvents)
+	api.mux.HandleFunc("/", api.handleDashboard)
+
+	return api
+}
+
+// Handle registers the handler on the mux of the API, it is protected by the token too
+func (api *HTTPAPI) Handle(pattern string, handler http.Handler) {
+	api.mux.Handle(pattern, handler)
+}
+
+func (api *HTTPAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !api.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+
+		return
+	}
+
+	if !api.allowedHost(r) {
+		writeError(w, http.StatusForbidden, "forbidden host")
+		return
+	}
+
+	if r.Method != http.MethodGet && !allowedOrigin(r) {
+		writeError(w, http.StatusForbidden, "forbidden origin")
+		return
+	}
+
+	api.mux.ServeHTTP(w, r)
+}
+
+// Close finishes event streams. You should call it before http.Server.Shutdown
+func (api *HTTPAPI) Close() {
+	api.closeOnce.Do(func() {
+		close(api.done)
+	})
+}
+
+func (api *HTTPAPI) authorized(r *http.Request) bool {
+	if api.token == "" {
+		return true
+	}
+
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) == 1
+}
+
+// allowedOrigin protects state-changing requests from other sites, requests without Origin are not sent by browsers
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+
+	return err == nil && parsed.Host == r.Host
+}
+
+// allowedHost protects the API without the token from DNS rebinding: a page of another site
+// can not resolve its host name to the local address and read services
+func (api *HTTPAPI) allowedHost(r *http.Request) bool {
+	if api.token != "" {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	return host == "localhost" || net.ParseIP(strings.Trim(host, "[]")) != nil
+}
+
+func (api *HTTPAPI) handleServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.sm.Status())
+}
+
+func (api *HTTPAPI) handleService(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/services/"), "/")
+	if len(parts) > 2 || parts[0] == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	name := parts[0]
+	if !api.sm.hasService(name) {
+		writeError(w, http.StatusNotFound, "unknown service "+name)
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	method := http.MethodPost
+	if action == "" || action == "tail" {
+		method = http.MethodGet
+	}
+
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch action {
+	case "":
+		for _, status := range api.sm.Status() {
+			if status.Name == name {
+				writeJSON(w, http.StatusOK, status)
+				return
+			}
+		}
+
+		// the instance is not created yet
+		writeJSON(w, http.StatusOK, ServiceStatus{Name: name})
+	case "tail":
+		lines := api.sm.Tail(name)
+		if lines == nil {
+			lines = []string{}
+		}
+
+		writeJSON(w, http.StatusOK, lines)
+	case ControlStart:
+		api.sm.Start(name)
+		writeJSON(w, http.StatusAccepted, struct{}{})
+	case ControlStop:
+		api.sm.Stop(name)
+		writeJSON(w, http.StatusAccepted, struct{}{})
+	case ControlRestart:
+		api.sm.Restart(name)
+		writeJSON(w, http.StatusAccepted, struct{}{})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handleEvents streams messages filtered by service and type query parameters.
+// Types are state, string and warning
+func (api *HTTPAPI) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	query := r.URL.Query()
+
+	types := make(map[MessageType]struct{})
+	for _, name := range query["type"] {
+		messageType, ok := messageTypeNames[name]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unknown type "+name)
+			return
+		}
+
+		types[messageType] = struct{}{}
+	}
+
+	subscription := api.events.Subscribe(query["service"])
+	defer api.events.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message, ok := <-subscription.C:
+			if !ok {
+				return
+			}
+
+			if _, ok := types[message.Type]; len(types) > 0 && !ok {
+				continue
+			}
+
+			data, err := json.Marshal(message)
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n",
+				message.Seq, messageTypeName(message.Type), data); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-api.done:
+			return
+		}
+	}
+}
+
+func messageTypeName(messageType MessageType) string {
+	return strings.ToLower(strings.TrimPrefix(messageType.String(), "Message"))
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, struct{ Error string }{message})
+}
+
+// localAddress binds the address without a host to localhost, "8080" and ":8080" are "127.0.0.1:8080"
+func localAddress(address string) string {
+	if !strings.Contains(address, ":") {
+		address = ":" + address
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host != "" {
+		return address
+	}
+
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// isLoopbackAddress checks that the address is bound to localhost
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPAPI(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		events        = NewBroadcaster()
+		startTemplate = regexp.MustCompile("ready")
+	)
+
+	m.Register("A", "service", []string{"lines", "hello,ready", "sleep", "10000"}, startTemplate, []string{})
+	m.AddSink(events)
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	go func() {
+		for range messages {
+		}
+	}()
+
+	api := NewHTTPAPI(m, events, "secret")
+	server := httptest.NewServer(api)
+
+	request := func(method, path, token string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp.StatusCode, string(body)
+	}
+
+	testCases := map[string]struct {
+		method string
+		path   string
+		token  string
+		code   int
+		body   string
+	}{
+		"no token": {
+			method: http.MethodGet,
+			path:   "/services",
+			code:   http.StatusUnauthorized,
+			body:   `{"Error":"unauthorized"}`,
+		},
+		"wrong token": {
+			method: http.MethodGet,
+			path:   "/services",
+			token:  "public",
+			code:   http.StatusUnauthorized,
+		},
+		"token parameter": {
+			method: http.MethodGet,
+			path:   "/services/A?token=secret",
+			code:   http.StatusOK,
+		},
+		"unknown service": {
+			method: http.MethodGet,
+			path:   "/services/B",
+			token:  "secret",
+			code:   http.StatusNotFound,
+			body:   `{"Error":"unknown service B"}`,
+		},
+		"unknown action": {
+			method: http.MethodPost,
+			path:   "/services/A/deploy",
+			token:  "secret",
+			code:   http.StatusNotFound,
+		},
+		"start with get": {
+			method: http.MethodGet,
+			path:   "/services/A/start",
+			token:  "secret",
+			code:   http.StatusMethodNotAllowed,
+		},
+		"dashboard": {
+			method: http.MethodGet,
+			path:   "/?token=secret",
+			code:   http.StatusOK,
+		},
+		"dashboard without token": {
+			method: http.MethodGet,
+			path:   "/",
+			code:   http.StatusUnauthorized,
+		},
+		"unknown path": {
+			method: http.MethodGet,
+			path:   "/index.html",
+			token:  "secret",
+			code:   http.StatusNotFound,
+		},
+		"tail": {
+			method: http.MethodGet,
+			path:   "/services/A/tail",
+			token:  "secret",
+			code:   http.StatusOK,
+			body:   `[]`,
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			code, body := request(tc.method, tc.path, tc.token)
+			assert.Equal(t, tc.code, code)
+
+			if tc.body != "" {
+				assert.Equal(t, tc.body+"\n", body)
+			}
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/events?service=A&type=state&token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the request of the dashboard
+	start, err := http.NewRequest(http.MethodPost, server.URL+"/services/A/start?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start.Header.Set("Origin", server.URL)
+
+	started, err := http.DefaultClient.Do(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started.Body.Close()
+	assert.Equal(t, http.StatusAccepted, started.StatusCode)
+
+	var (
+		reader = bufio.NewReader(resp.Body)
+		states = []State{}
+	)
+
+	for len(states) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		var message ServiceMessage
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message); err != nil {
+			t.Fatal(err)
+		}
+
+		states = append(states, message.State)
+	}
+
+	assert.Equal(t, []State{StateStarted, StateRunning}, states)
+
+	code, body := request(http.MethodGet, "/services", "secret")
+	assert.Equal(t, http.StatusOK, code)
+
+	var status []ServiceStatus
+	if assert.NoError(t, json.Unmarshal([]byte(body), &status)) && assert.Len(t, status, 1) {
+		assert.Equal(t, StateRunning, status[0].State)
+	}
+
+	api.Close()
+	resp.Body.Close()
+	server.Close()
+	m.Close()
+}
+
+func TestHTTPAPIOrigin(t *testing.T) {
+	m := NewServiceManager()
+	m.Register("A", "service", []string{}, nil, []string{})
+
+	api := NewHTTPAPI(m, NewBroadcaster(), "")
+	server := httptest.NewServer(api)
+
+	defer func() {
+		api.Close()
+		server.Close()
+	}()
+
+	testCases := map[string]struct {
+		method string
+		path   string
+		origin string
+		host   string
+		body   string
+	}{
+		"foreign origin": {
+			method: http.MethodPost,
+			path:   "/services/A/stop",
+			origin: "http://example.com",
+			body:   "forbidden origin",
+		},
+		"invalid origin": {
+			method: http.MethodPost,
+			path:   "/services/A/stop",
+			origin: "://",
+			body:   "forbidden origin",
+		},
+		"dns rebinding": {
+			method: http.MethodPost,
+			path:   "/services/A/stop",
+			origin: "http://example.com:8080",
+			host:   "example.com:8080",
+			body:   "forbidden host",
+		},
+		"foreign host": {
+			method: http.MethodPost,
+			path:   "/services/A/stop",
+			host:   "example.com",
+			body:   "forbidden host",
+		},
+		"tail of foreign host": {
+			method: http.MethodGet,
+			path:   "/services/A/tail",
+			host:   "example.com",
+			body:   "forbidden host",
+		},
+		"events of foreign host": {
+			method: http.MethodGet,
+			path:   "/events",
+			host:   "example.com",
+			body:   "forbidden host",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, server.URL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Equal(t, `{"Error":"`+tc.body+`"}`+"\n", string(body))
+		})
+	}
+
+	// the local host can read services without the token
+	resp, err := http.Get(server.URL + "/services/A/tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestLocalAddress(t *testing.T) {
+	testCases := map[string]struct {
+		address  string
+		expected string
+		loopback bool
+	}{
+		"port": {
+			address:  "8080",
+			expected: "127.0.0.1:8080",
+			loopback: true,
+		},
+		"no host": {
+			address:  ":8080",
+			expected: "127.0.0.1:8080",
+			loopback: true,
+		},
+		"localhost": {
+			address:  "localhost:8080",
+			expected: "localhost:8080",
+			loopback: true,
+		},
+		"ipv6 loopback": {
+			address:  "[::1]:8080",
+			expected: "[::1]:8080",
+			loopback: true,
+		},
+		"all interfaces": {
+			address:  "0.0.0.0:8080",
+			expected: "0.0.0.0:8080",
+			loopback: false,
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			address := localAddress(tc.address)
+			assert.Equal(t, tc.expected, address)
+			assert.Equal(t, tc.loopback, isLoopbackAddress(address))
+		})
+	}
+}
@@ -34,6 +34,38 @@ func deduplicateOrder(order []string) []string {
 	return o
 }
 
+// ReverseRequirements returns dependents of every service
+func ReverseRequirements(requirements map[string][]string) map[string][]string {
+	dependents := make(map[string][]string)
+
+	for name, parents := range requirements {
+		for _, parent := range parents {
+			dependents[parent] = append(dependents[parent], name)
+		}
+	}
+
+	for name := range dependents {
+		services := dependents[name]
+		sort.Slice(services, func(i, j int) bool {
+			return services[i] < services[j]
+		})
+	}
+
+	return dependents
+}
+
+// SortByPriority orders services by descending priority, services with the same priority are ordered by name
+func SortByPriority(services []string, priorities map[string]int) {
+	sort.Slice(services, func(i, j int) bool {
+		left, right := priorities[services[i]], priorities[services[j]]
+		if left != right {
+			return left > right
+		}
+
+		return services[i] < services[j]
+	})
+}
+
 // -1 we in
 //  1 visited
 func IsRequirementsAcyclic(requirements map[string][]string) bool {
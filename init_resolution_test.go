@@ -118,6 +118,81 @@ func TestInitOrder(t *testing.T) {
 		})
 	}
 }
+func TestReverseRequirements(t *testing.T) {
+	testCases := map[string]struct {
+		requirements map[string][]string
+		expected     map[string][]string
+	}{
+		"empty": {
+			requirements: map[string][]string{},
+			expected:     map[string][]string{},
+		},
+		"diamond": {
+			requirements: map[string][]string{
+				"s": {
+					"b", "a",
+				},
+				"a": {
+					"c",
+				},
+				"b": {
+					"c",
+				},
+			},
+			expected: map[string][]string{
+				"a": {"s"},
+				"b": {"s"},
+				"c": {"a", "b"},
+			},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			result := ReverseRequirements(tc.requirements)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestSortByPriority(t *testing.T) {
+	testCases := map[string]struct {
+		services   []string
+		priorities map[string]int
+		expected   []string
+	}{
+		"empty": {
+			services:   []string{},
+			priorities: map[string]int{},
+			expected:   []string{},
+		},
+		"no priorities": {
+			services:   []string{"c", "a", "b"},
+			priorities: map[string]int{},
+			expected:   []string{"a", "b", "c"},
+		},
+		"priorities": {
+			services: []string{"a", "b", "c", "d"},
+			priorities: map[string]int{
+				"c": 10,
+				"b": 5,
+				"d": 5,
+				"a": -1,
+			},
+			expected: []string{"c", "b", "d", "a"},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			SortByPriority(tc.services, tc.priorities)
+			assert.Equal(t, tc.expected, tc.services)
+		})
+	}
+}
+
 func TestAcyclic(t *testing.T) {
 	testCases := map[string]struct {
 		requirements map[string][]string
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cpuPeriod is the period of cpu.max in microseconds
+const cpuPeriod = 100000
+
+// limitsEnv passes execLimits to the manager executable that applies them before exec of the command
+const limitsEnv = "SERVICES_EXEC_LIMITS"
+
+// exitLimitsFailed is the exit code of the service when limits can not be applied
+const exitLimitsFailed = 126
+
+// ResourceLimits of the service process. OpenFiles and Processes are set by setrlimit,
+// Memory, CPU and Processes are set by the cgroup of the service if the cgroup root is set,
+// see ServiceManager.SetCgroupRoot. Limits are applied before exec of the command,
+// so the command and its children can not escape them. Zero means no limit
+type ResourceLimits struct {
+	// Memory is memory.max in bytes, the service fails with FailureReasonOOM if it is killed by the OOM killer
+	Memory uint64
+	// CPU is the number of cores, cpu.max
+	CPU float64
+	// OpenFiles is RLIMIT_NOFILE
+	OpenFiles uint64
+	// Processes is pids.max and RLIMIT_NPROC. Note that RLIMIT_NPROC counts all processes of the user
+	Processes uint64
+}
+
+// SetCgroupRoot sets the cgroup v2 directory where every started service gets its own cgroup with limits.
+// The directory should be delegated to the user of the manager and should not contain processes itself,
+// like a systemd unit with Delegate=yes. Cgroups are not used if the root is empty
+func (sm *ServiceManager) SetCgroupRoot(path string) {
+	sm.cgroupRoot = path
+}
+
+// execLimits are applied by the manager executable started instead of the command, see execLimited
+type execLimits struct {
+	OpenFiles uint64
+	Processes uint64
+	// Cgroup is the directory of the cgroup, empty if the cgroup is not used
+	Cgroup string
+}
+
+func init() {
+	if os.Getenv(limitsEnv) != "" {
+		execLimited()
+	}
+}
+
+// applyLimits creates the cgroup of the service and replaces the command with the manager executable
+// that applies Limits to itself and executes the command. Errors are logged and the command is started without limits
+func (s *Service) applyLimits() {
+	s.cgroup = nil
+
+	limits := execLimits{
+		OpenFiles: s.Limits.OpenFiles,
+		Processes: s.Limits.Processes,
+	}
+
+	if (limits.OpenFiles > 0 || limits.Processes > 0) && !limitsSupported {
+		log.Printf("Limits of %s are not applied: limits are supported only on linux", s.Name)
+
+		limits.OpenFiles = 0
+		limits.Processes = 0
+	}
+
+	switch {
+	case s.cgroupRoot != "":
+		group, err := newCgroup(s.cgroupRoot, s.Name, s.Limits)
+		if err != nil {
+			log.Printf("Can not create the cgroup of %s: %v", s.Name, err)
+			break
+		}
+
+		s.cgroup = group
+		limits.Cgroup = group.path
+	case s.Limits.Memory > 0 || s.Limits.CPU > 0:
+		log.Printf("Memory and CPU limits of %s are not applied without the cgroup root", s.Name)
+	}
+
+	if limits == (execLimits{}) {
+		return
+	}
+
+	// the start fails with the lookup error
+	if _, err := exec.LookPath(s.cmd.Path); err != nil {
+		return
+	}
+
+	executable, err := os.Executable()
+	if err == nil {
+		var data []byte
+
+		data, err = json.Marshal(limits)
+		if err == nil {
+			env := s.cmd.Env
+			if env == nil {
+				env = os.Environ()
+			}
+
+			s.cmd.Env = append(env, limitsEnv+"="+string(data))
+			s.cmd.Args = append([]string{executable, s.cmd.Path}, s.cmd.Args...)
+			s.cmd.Path = executable
+
+			return
+		}
+	}
+
+	log.Printf("Can not apply limits of %s: %v", s.Name, err)
+}
+
+// execLimited applies limits of limitsEnv to the current process and executes the command of arguments:
+// the path and the arguments with the name of the command. Errors are printed to the output of the service
+func execLimited() {
+	var limits execLimits
+
+	err := json.Unmarshal([]byte(os.Getenv(limitsEnv)), &limits)
+	if err == nil && len(os.Args) < 3 {
+		err = errors.New("no command")
+	}
+
+	if err == nil && limits.Cgroup != "" {
+		err = (&cgroup{path: limits.Cgroup}).add(os.Getpid())
+	}
+
+	if err == nil && (limits.OpenFiles > 0 || limits.Processes > 0) {
+		err = setRlimits(os.Getpid(), ResourceLimits{OpenFiles: limits.OpenFiles, Processes: limits.Processes})
+	}
+
+	if err == nil {
+		env := make([]string, 0, len(os.Environ()))
+
+		for _, value := range os.Environ() {
+			if !strings.HasPrefix(value, limitsEnv+"=") {
+				env = append(env, value)
+			}
+		}
+
+		err = syscall.Exec(os.Args[1], os.Args[2:], env)
+	}
+
+	fmt.Println("Can not apply limits:", err)
+	os.Exit(exitLimitsFailed)
+}
+
+// cgroup is the cgroup v2 of the service
+type cgroup struct {
+	path string
+	// oom_kill of memory.events when the cgroup was created
+	oomKills uint64
+}
+
+// newCgroup creates the cgroup of the service in the root and writes limits to it.
+// Controllers of limits are enabled in the root
+func newCgroup(root, name string, limits ResourceLimits) (*cgroup, error) {
+	// a controller may be enabled already or not be available, then writing its limit fails
+	for _, controller := range []string{"+memory", "+cpu", "+pids"} {
+		_ = ioutil.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte(controller), 0644)
+	}
+
+	path := filepath.Join(root, name)
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	var values [][2]string
+
+	if limits.Memory > 0 {
+		values = append(values, [2]string{"memory.max", strconv.FormatUint(limits.Memory, 10)})
+	}
+
+	if limits.CPU > 0 {
+		values = append(values, [2]string{"cpu.max", fmt.Sprintf("%d %d", int64(limits.CPU*cpuPeriod), cpuPeriod)})
+	}
+
+	if limits.Processes > 0 {
+		values = append(values, [2]string{"pids.max", strconv.FormatUint(limits.Processes, 10)})
+	}
+
+	for _, value := range values {
+		if err := ioutil.WriteFile(filepath.Join(path, value[0]), []byte(value[1]), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	group := &cgroup{path: path}
+	group.oomKills = group.readOOMKills()
+
+	return group, nil
+}
+
+// add moves the process into the cgroup, its children are created in the cgroup
+func (c *cgroup) add(pid int) error {
+	return ioutil.WriteFile(filepath.Join(c.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// oomKilled checks that the OOM killer killed a process of the cgroup after it was created
+func (c *cgroup) oomKilled() bool {
+	return c.readOOMKills() > c.oomKills
+}
+
+// readOOMKills returns oom_kill of memory.events, zero if it is not available
+func (c *cgroup) readOOMKills() uint64 {
+	data, err := ioutil.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 2 && string(fields[0]) == "oom_kill" {
+			value, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+			return value
+		}
+	}
+
+	return 0
+}
+
+// remove removes the cgroup, it is kept if processes of the service are still running
+func (c *cgroup) remove() {
+	_ = os.Remove(c.path)
+}
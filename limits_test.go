@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroup(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	group, err := newCgroup(root, "api", ResourceLimits{Memory: 256 << 20, CPU: 1.5, Processes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, group.add(42))
+
+	for file, expected := range map[string]string{
+		"memory.max":   "268435456",
+		"cpu.max":      "150000 100000",
+		"pids.max":     "10",
+		"cgroup.procs": "42",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(root, "api", file))
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, string(data), file)
+		}
+	}
+
+	assert.False(t, group.oomKilled())
+
+	events := filepath.Join(root, "api", "memory.events")
+	if err := ioutil.WriteFile(events, []byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, group.oomKilled())
+
+	// OOM kills of previous processes are not counted
+	group, err = newCgroup(root, "api", ResourceLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.False(t, group.oomKilled())
+}
+
+func TestServiceLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("limits require linux")
+	}
+
+	defer setHelperCommand(t)()
+
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	service := NewService("A", "service", []string{"sleep", "100", "nofile", "env", limitsEnv, "sleep", "300", "error"}, nil)
+	service.Limits = ResourceLimits{OpenFiles: 64}
+	service.cgroupRoot = root
+
+	recorded := []ServiceMessage{}
+
+	for message := range service.Start(context.TODO()) {
+		if message.Type == MessageString {
+			// the memory of the cgroup was exceeded before the exit
+			err := ioutil.WriteFile(filepath.Join(root, "A", "memory.events"), []byte("oom_kill 1\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		recorded = append(recorded, message)
+	}
+
+	procs, err := ioutil.ReadFile(filepath.Join(root, "A", "cgroup.procs"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, strconv.Itoa(service.cmd.Process.Pid), string(procs))
+	}
+
+	// limits are applied before exec of the command, the command does not see them in the environment
+	if assert.Len(t, recorded, 5) {
+		assert.Equal(t, "64", recorded[2].Value)
+		assert.Equal(t, "", recorded[3].Value)
+		assert.Equal(t, StateFailed, recorded[4].State)
+		assert.Equal(t, FailureReasonOOM, recorded[4].FailureReason)
+	}
+}
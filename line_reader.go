@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxLineLength is used when Service.MaxLineLength is zero
+const DefaultMaxLineLength = 64 * 1024
+
+// lineReader reads output lines of the service.
+// Lines longer than max bytes are truncated or split, invalid UTF-8 is replaced with U+FFFD
+// and carriage return without new line overwrites the line like a terminal does,
+// so only the last state of a progress bar is returned
+type lineReader struct {
+	reader *bufio.Reader
+	max    int
+	split  bool
+
+	line []byte
+	// bytes truncated from the current line
+	dropped int
+	// carriage return was the last byte
+	cr      bool
+	pending []string
+	err     error
+}
+
+func newLineReader(reader io.Reader, max int, split bool) *lineReader {
+	if max <= 0 {
+		max = DefaultMaxLineLength
+	}
+
+	return &lineReader{
+		reader: bufio.NewReader(reader),
+		max:    max,
+		split:  split,
+	}
+}
+
+// ReadLine returns the next line without the line ending.
+// The last line is returned even if it has no line ending
+func (r *lineReader) ReadLine() (string, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return "", r.err
+		}
+
+		chunk, err := r.reader.ReadSlice('\n')
+
+		switch err {
+		case nil:
+			r.append(chunk[:len(chunk)-1])
+			r.finish()
+		case bufio.ErrBufferFull:
+			r.append(chunk)
+		default:
+			r.append(chunk)
+
+			if len(r.line) > 0 || r.dropped > 0 {
+				r.finish()
+			}
+
+			r.err = err
+		}
+	}
+
+	line := r.pending[0]
+	r.pending = r.pending[1:]
+
+	return line, nil
+}
+
+func (r *lineReader) append(chunk []byte) {
+	for len(chunk) > 0 {
+		if r.cr {
+			r.cr = false
+			r.reset()
+		}
+
+		i := bytes.IndexByte(chunk, '\r')
+		if i < 0 {
+			r.write(chunk)
+			return
+		}
+
+		r.write(chunk[:i])
+		r.cr = true
+		chunk = chunk[i+1:]
+	}
+}
+
+func (r *lineReader) write(chunk []byte) {
+	if r.split {
+		for len(r.line)+len(chunk) > r.max {
+			n := r.max - len(r.line)
+
+			// do not split runes if possible
+			for i := n; i > 0; i-- {
+				if utf8.RuneStart(chunk[i]) {
+					n = i
+					break
+				}
+			}
+
+			r.line = append(r.line, chunk[:n]...)
+			r.pending = append(r.pending, r.text())
+			r.line = r.line[:0]
+			chunk = chunk[n:]
+		}
+	} else if free := r.max - len(r.line); len(chunk) > free {
+		r.dropped += len(chunk) - free
+		chunk = chunk[:free]
+	}
+
+	r.line = append(r.line, chunk...)
+}
+
+func (r *lineReader) finish() {
+	line := r.text()
+	if r.dropped > 0 {
+		line += fmt.Sprintf(" [%d bytes truncated]", r.dropped)
+	}
+
+	r.pending = append(r.pending, line)
+	r.cr = false
+	r.reset()
+}
+
+func (r *lineReader) reset() {
+	r.line = r.line[:0]
+	r.dropped = 0
+}
+
+func (r *lineReader) text() string {
+	return strings.ToValidUTF8(string(r.line), "�")
+}
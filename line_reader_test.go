@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineReader(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		max      int
+		split    bool
+		expected []string
+	}{
+		"empty": {
+			input:    "",
+			expected: []string{},
+		},
+		"lines": {
+			input:    "a\n\nb\n",
+			expected: []string{"a", "", "b"},
+		},
+		"no new line at the end": {
+			input:    "a\nb",
+			expected: []string{"a", "b"},
+		},
+		"crlf": {
+			input:    "a\r\nb\r\n",
+			expected: []string{"a", "b"},
+		},
+		"progress bar": {
+			input:    "10%\r50%\r100%\ndone\n",
+			expected: []string{"100%", "done"},
+		},
+		"progress bar without new line": {
+			input:    "10%\r50%\r",
+			expected: []string{"50%"},
+		},
+		"invalid utf-8": {
+			input:    "a\xffb\n",
+			expected: []string{"a�b"},
+		},
+		"truncate": {
+			input:    "0123456789\nabc\n",
+			max:      4,
+			expected: []string{"0123 [6 bytes truncated]", "abc"},
+		},
+		"truncate progress bar": {
+			input:    "0123456789\r01\n",
+			max:      4,
+			expected: []string{"01"},
+		},
+		"split": {
+			input:    "0123456789\nabc\n",
+			max:      4,
+			split:    true,
+			expected: []string{"0123", "4567", "89", "abc"},
+		},
+		"split runes": {
+			input:    "aбв\n",
+			max:      4,
+			split:    true,
+			expected: []string{"aб", "в"},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			reader := newLineReader(strings.NewReader(tc.input), tc.max, tc.split)
+			lines := []string{}
+
+			for {
+				line, err := reader.ReadLine()
+				if err != nil {
+					assert.Equal(t, io.EOF, err)
+					break
+				}
+
+				lines = append(lines, line)
+			}
+
+			assert.Equal(t, tc.expected, lines)
+		})
+	}
+}
+
+func TestLineReaderLongLine(t *testing.T) {
+	input := strings.Repeat("x", 10*DefaultMaxLineLength) + "\nok\n"
+	reader := newLineReader(strings.NewReader(input), 0, false)
+
+	line, err := reader.ReadLine()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, strings.Repeat("x", DefaultMaxLineLength)+" ["))
+
+	line, err = reader.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", line)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CombinedLogName is the file name of the combined log of all services
+	CombinedLogName = "combined.log"
+
+	backupTimeFormat = "2006-01-02T15-04-05.000000000"
+	logTimeFormat    = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// LogRotation configures rotation of log files, zero values disable the limits
+type LogRotation struct {
+	// MaxSize rotates the file before it exceeds the size in bytes
+	MaxSize int64
+	// MaxAge rotates the file when it was opened longer ago than the duration
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep
+	MaxBackups int
+	// Retention removes rotated files older than the duration
+	Retention time.Duration
+	// Compress rotated files with gzip
+	Compress bool
+}
+
+// rotatingFile is an append only file rotated by LogRotation.
+// Rotated files are renamed to path.<time> and path.<time>.gz if compressed
+type rotatingFile struct {
+	path     string
+	rotation LogRotation
+	file     *os.File
+	size     int64
+	opened   time.Time
+	now      func() time.Time
+	// waits for compression and cleanup of rotated files
+	wg sync.WaitGroup
+	// serializes compression and cleanup
+	mu sync.Mutex
+}
+
+func openRotatingFile(path string, rotation LogRotation) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:     path,
+		rotation: rotation,
+		now:      time.Now,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.now()
+
+	// the age of an existing file is counted from the last write
+	if f.size > 0 {
+		f.opened = info.ModTime()
+	}
+
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+func (f *rotatingFile) shouldRotate(size int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	if f.rotation.MaxSize > 0 && f.size+size > f.rotation.MaxSize {
+		return true
+	}
+
+	return f.rotation.MaxAge > 0 && f.now().Sub(f.opened) >= f.rotation.MaxAge
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	backup := f.path + "." + f.now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+
+	go func() {
+		defer f.wg.Done()
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if f.rotation.Compress {
+			if err := compressFile(backup); err != nil {
+				log.Printf("Error compressing %s: %v", backup, err)
+			}
+		}
+
+		f.removeBackups()
+	}()
+
+	return nil
+}
+
+// backups returns rotated files from the oldest to the newest
+func (f *rotatingFile) backups() ([]string, error) {
+	dir, base := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	names, err := file.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+
+	for _, name := range names {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if len(suffix) == len(name) {
+			continue
+		}
+
+		if _, err := time.Parse(backupTimeFormat, suffix); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	// time format is sorted lexicographically
+	sort.Strings(backups)
+
+	return backups, nil
+}
+
+// removeBackups removes rotated files over MaxBackups and older than Retention
+func (f *rotatingFile) removeBackups() {
+	if f.rotation.MaxBackups <= 0 && f.rotation.Retention <= 0 {
+		return
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		log.Printf("Error listing backups of %s: %v", f.path, err)
+		return
+	}
+
+	for i, backup := range backups {
+		remove := f.rotation.MaxBackups > 0 && len(backups)-i > f.rotation.MaxBackups
+
+		if !remove && f.rotation.Retention > 0 {
+			info, err := os.Stat(backup)
+			remove = err == nil && f.now().Sub(info.ModTime()) > f.rotation.Retention
+		}
+
+		if !remove {
+			continue
+		}
+
+		if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing %s: %v", backup, err)
+		}
+	}
+}
+
+// Close closes the file and waits for rotated files to be processed
+func (f *rotatingFile) Close() error {
+	err := f.file.Close()
+	f.wg.Wait()
+
+	return err
+}
+
+// compressFile replaces the file with path.gz
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// LogSink is MessageSink that writes messages of every service to <dir>/<name>.log
+// and optionally all messages to <dir>/combined.log
+type LogSink struct {
+	dir      string
+	rotation LogRotation
+	files    map[string]*rotatingFile
+	combined *rotatingFile
+}
+
+func NewLogSink(dir string, rotation LogRotation, combined bool) (*LogSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	sink := &LogSink{
+		dir:      dir,
+		rotation: rotation,
+		files:    make(map[string]*rotatingFile),
+	}
+
+	if combined {
+		file, err := openRotatingFile(filepath.Join(dir, CombinedLogName), rotation)
+		if err != nil {
+			return nil, err
+		}
+
+		sink.combined = file
+	}
+
+	return sink, nil
+}
+
+// HandleMessage writes the message to log files, errors are logged
+func (l *LogSink) HandleMessage(message ServiceMessage) {
+	file, err := l.file(message.Name)
+	if err != nil {
+		log.Printf("Error opening log of %s: %v", message.Name, err)
+		return
+	}
+
+	var (
+		timestamp = message.Time.Format(logTimeFormat)
+		line      = formatLogLine(message)
+	)
+
+	if _, err := fmt.Fprintf(file, "%s %s\n", timestamp, line); err != nil {
+		log.Printf("Error writing log of %s: %v", message.Name, err)
+	}
+
+	if l.combined == nil {
+		return
+	}
+
+	if _, err := fmt.Fprintf(l.combined, "%s %s | %s\n", timestamp, message.Name, line); err != nil {
+		log.Print("Error writing combined log: ", err)
+	}
+}
+
+// serviceLogName returns the file name of the log of the service, separators of paths are replaced
+// to keep the file in the logs directory
+func serviceLogName(name string) (string, error) {
+	fileName := strings.NewReplacer("/", "_", `\`, "_").Replace(name) + ".log"
+	if fileName == CombinedLogName {
+		return "", fmt.Errorf("%s is the combined log", fileName)
+	}
+
+	return fileName, nil
+}
+
+func (l *LogSink) file(name string) (*rotatingFile, error) {
+	if file, ok := l.files[name]; ok {
+		return file, nil
+	}
+
+	fileName, err := serviceLogName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := openRotatingFile(filepath.Join(l.dir, fileName), l.rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	l.files[name] = file
+
+	return file, nil
+}
+
+// Close closes all log files. You should call it after ServiceManager.Close
+func (l *LogSink) Close() error {
+	var result error
+
+	for _, file := range l.files {
+		if err := file.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	if l.combined != nil {
+		if err := l.combined.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// formatLogLine formats the message without the time and the line break
+func formatLogLine(message ServiceMessage) string {
+	switch message.Type {
+	case MessageState:
+		line := fmt.Sprintf("[%s]", message.State)
+		if message.Value != "" {
+			line += " " + message.Value
+		}
+
+		if message.Exit != nil {
+			line += fmt.Sprintf(" (exit code %d)", message.Exit.Code)
+		}
+
+		return line
+	case MessageWarning:
+		return "[warning] " + message.Value
+	default:
+		return message.Value
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	testCases := map[string]struct {
+		rotation LogRotation
+		step     time.Duration
+		writes   int
+		backups  int
+	}{
+		"no rotation": {
+			writes:  5,
+			backups: 0,
+		},
+		"size": {
+			rotation: LogRotation{MaxSize: 10},
+			writes:   5,
+			backups:  4,
+		},
+		"size with max backups": {
+			rotation: LogRotation{MaxSize: 10, MaxBackups: 2},
+			writes:   5,
+			backups:  2,
+		},
+		"age": {
+			rotation: LogRotation{MaxAge: time.Hour},
+			step:     40 * time.Minute,
+			writes:   5,
+			backups:  2,
+		},
+		"compress": {
+			rotation: LogRotation{MaxSize: 10, Compress: true},
+			writes:   3,
+			backups:  2,
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rotating")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "test.log")
+			now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+			f, err := openRotatingFile(path, tc.rotation)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f.now = func() time.Time { return now }
+			f.opened = now
+
+			for i := 0; i < tc.writes; i++ {
+				// every rotated file should have a unique name
+				now = now.Add(tc.step + time.Millisecond)
+
+				_, err := f.Write([]byte("line ~~\n"))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			backups, err := f.backups()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Len(t, backups, tc.backups)
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NotEmpty(t, data)
+
+			for _, backup := range backups {
+				assert.Equal(t, tc.rotation.Compress, strings.HasSuffix(backup, ".gz"))
+			}
+		})
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+
+	f, err := openRotatingFile(path, LogRotation{MaxSize: 8, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Write([]byte("first\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("second\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, backups, 1) {
+		return
+	}
+
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "first\n", string(data))
+
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "second\n", string(data))
+}
+
+func TestRotatingFileRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+	old := path + "." + time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Format(backupTimeFormat)
+
+	if err := ioutil.WriteFile(old, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(old, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := openRotatingFile(path, LogRotation{MaxSize: 4, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Write([]byte("new\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("new\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, backups, 1) {
+		return
+	}
+	assert.NotEqual(t, old, backups[0])
+}
+
+func TestLogSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := NewLogSink(dir, LogRotation{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []ServiceMessage{
+		{Name: "a", Type: MessageState, State: StateRunning},
+		{Name: "a", Type: MessageString, Value: "hello"},
+		{Name: "b", Type: MessageWarning, Value: "careful"},
+		{Name: "a", Type: MessageState, State: StateFailed, Value: "exit status 1", Exit: &ExitStatus{Code: 1}},
+	}
+
+	for _, message := range messages {
+		sink.HandleMessage(stamp(message))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readLines := func(name string) []string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		for i, line := range lines {
+			// strip the timestamp
+			lines[i] = line[strings.Index(line, " ")+1:]
+		}
+
+		return lines
+	}
+
+	assert.Equal(t, []string{
+		"[StateRunning]",
+		"hello",
+		"[StateFailed] exit status 1 (exit code 1)",
+	}, readLines("a.log"))
+	assert.Equal(t, []string{
+		"[warning] careful",
+	}, readLines("b.log"))
+	assert.Equal(t, []string{
+		"a | [StateRunning]",
+		"a | hello",
+		"b | [warning] careful",
+		"a | [StateFailed] exit status 1 (exit code 1)",
+	}, readLines(CombinedLogName))
+}
+
+func TestLogSinkCombinedName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := NewLogSink(dir, LogRotation{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = sink.file("combined")
+	assert.EqualError(t, err, "combined.log is the combined log")
+	assert.NoError(t, sink.Close())
+}
+
+func TestServiceLogName(t *testing.T) {
+	testCases := map[string]struct {
+		name     string
+		expected string
+		err      string
+	}{
+		"service":         {name: "api", expected: "api.log"},
+		"instance":        {name: "worker@1", expected: "worker@1.log"},
+		"slash":           {name: "../api", expected: ".._api.log"},
+		"backslash":       {name: `..\api`, expected: ".._api.log"},
+		"combined":        {name: "combined", err: "combined.log is the combined log"},
+		"combined prefix": {name: "combined/", expected: "combined_.log"},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fileName, err := serviceLogName(testCase.name)
+			if testCase.err != "" {
+				assert.EqualError(t, err, testCase.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, fileName)
+		})
+	}
+}
+
+func TestServiceManagerLogSink(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	dir, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := NewLogSink(dir, LogRotation{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewServiceManager()
+	m.Register("a", "service", []string{"lines", "one,two"}, nil, []string{})
+	m.AddSink(sink)
+
+	output, err := m.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go m.Start("a")
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case message := <-output:
+			if message.Type == MessageState && message.State == StateFinished {
+				break loop
+			}
+		case <-ticker.C:
+			t.Fatal("Timeout")
+		}
+	}
+
+	go func() {
+		for range output {
+		}
+	}()
+	m.Close()
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(data), " one\n")
+	assert.Contains(t, string(data), " two\n")
+	assert.Contains(t, string(data), "[StateFinished]")
+}
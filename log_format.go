@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Normalized names of structured log fields
+const (
+	FieldLevel   = "level"
+	FieldMessage = "msg"
+	FieldTime    = "time"
+)
+
+// fieldAliases are common names of fields with the normalized names,
+// the first alias present in the line is used if there are several ones
+var fieldAliases = []struct {
+	alias string
+	name  string
+}{
+	{"lvl", FieldLevel},
+	{"severity", FieldLevel},
+	{"message", FieldMessage},
+	{"ts", FieldTime},
+	{"timestamp", FieldTime},
+	{"@timestamp", FieldTime},
+}
+
+// parseFields parses the output line in the format, nil is returned if the line can not be parsed
+func parseFields(format LogFormat, line string) map[string]string {
+	var fields map[string]string
+
+	switch format {
+	case LogFormatJSON:
+		fields = parseJSONFields(line)
+	case LogFormatLogfmt:
+		fields = parseLogfmtFields(line)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return normalizeFields(fields)
+}
+
+// parseJSONFields parses the JSON object, nested values are kept as JSON
+func parseJSONFields(line string) map[string]string {
+	var object map[string]json.RawMessage
+
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+
+	fields := make(map[string]string, len(object))
+
+	for key, raw := range object {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			fields[key] = value
+			continue
+		}
+
+		raw = bytes.TrimSpace(raw)
+		if string(raw) == "null" {
+			fields[key] = ""
+			continue
+		}
+
+		fields[key] = string(raw)
+	}
+
+	return fields
+}
+
+// parseLogfmtFields parses key=value pairs separated by spaces, values can be quoted.
+// A key without a value is parsed as "true", plain text without key=value pairs is not parsed
+func parseLogfmtFields(line string) map[string]string {
+	var (
+		fields = make(map[string]string)
+		pairs  = 0
+	)
+
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			if pairs == 0 {
+				return nil
+			}
+
+			return fields
+		}
+
+		end := strings.IndexFunc(line, func(r rune) bool {
+			return r == '=' || unicode.IsSpace(r)
+		})
+		if end == 0 {
+			// value without a key
+			return nil
+		}
+
+		if end < 0 {
+			end = len(line)
+		}
+
+		key := line[:end]
+		line = line[end:]
+
+		if !strings.HasPrefix(line, "=") {
+			fields[key] = "true"
+			continue
+		}
+
+		line = line[1:]
+
+		value, rest, ok := logfmtValue(line)
+		if !ok {
+			return nil
+		}
+
+		fields[key] = value
+		line = rest
+		pairs++
+	}
+}
+
+// logfmtValue reads the value at the start of the line and returns the rest of the line
+func logfmtValue(line string) (string, string, bool) {
+	if !strings.HasPrefix(line, `"`) {
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			end = len(line)
+		}
+
+		return line[:end], line[end:], true
+	}
+
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(line[:i+1])
+			if err != nil {
+				return "", "", false
+			}
+
+			return value, line[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+// normalizeFields renames aliases of level, msg and time fields and lowercases the level.
+// Aliases are kept if the normalized field already exists
+func normalizeFields(fields map[string]string) map[string]string {
+	for _, field := range fieldAliases {
+		value, ok := fields[field.alias]
+		if !ok {
+			continue
+		}
+
+		if _, exists := fields[field.name]; exists {
+			continue
+		}
+
+		fields[field.name] = value
+		delete(fields, field.alias)
+	}
+
+	if level, ok := fields[FieldLevel]; ok {
+		fields[FieldLevel] = strings.ToLower(level)
+	}
+
+	return fields
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFields(t *testing.T) {
+	testCases := map[string]struct {
+		format   LogFormat
+		input    string
+		expected map[string]string
+	}{
+		"none": {
+			format:   LogFormatNone,
+			input:    `{"msg":"hello"}`,
+			expected: nil,
+		},
+		"json": {
+			format: LogFormatJSON,
+			input:  `{"level":"INFO","msg":"hello","port":8080,"ok":true,"tags":["a","b"],"err":null}`,
+			expected: map[string]string{
+				"level": "info",
+				"msg":   "hello",
+				"port":  "8080",
+				"ok":    "true",
+				"tags":  `["a","b"]`,
+				"err":   "",
+			},
+		},
+		"json aliases": {
+			format: LogFormatJSON,
+			input:  `{"severity":"Warning","message":"slow","@timestamp":"2020-01-01T00:00:00Z"}`,
+			expected: map[string]string{
+				"level": "warning",
+				"msg":   "slow",
+				"time":  "2020-01-01T00:00:00Z",
+			},
+		},
+		"json conflicting aliases": {
+			format: LogFormatJSON,
+			input:  `{"level":"info","lvl":"debug","severity":"ERROR","ts":"1","timestamp":"2","@timestamp":"3"}`,
+			expected: map[string]string{
+				"level":      "info",
+				"lvl":        "debug",
+				"severity":   "ERROR",
+				"time":       "1",
+				"timestamp":  "2",
+				"@timestamp": "3",
+			},
+		},
+		"json not object": {
+			format:   LogFormatJSON,
+			input:    `plain text`,
+			expected: nil,
+		},
+		"logfmt": {
+			format: LogFormatLogfmt,
+			input:  `lvl=error ts=2020-01-01T00:00:00Z msg="can not connect" addr=localhost:5432 retry`,
+			expected: map[string]string{
+				"level": "error",
+				"msg":   "can not connect",
+				"time":  "2020-01-01T00:00:00Z",
+				"addr":  "localhost:5432",
+				"retry": "true",
+			},
+		},
+		"logfmt escaped quote": {
+			format: LogFormatLogfmt,
+			input:  `msg="say \"hi\"" empty=`,
+			expected: map[string]string{
+				"msg":   `say "hi"`,
+				"empty": "",
+			},
+		},
+		"logfmt unterminated quote": {
+			format:   LogFormatLogfmt,
+			input:    `msg="hello`,
+			expected: nil,
+		},
+		"logfmt plain text": {
+			format:   LogFormatLogfmt,
+			input:    `Starting server on port 8080`,
+			expected: nil,
+		},
+		"logfmt value without key": {
+			format:   LogFormatLogfmt,
+			input:    `=value`,
+			expected: nil,
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			result := parseFields(tc.format, tc.input)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeToRunningBuckets are upper bounds of the time to running histogram in seconds
+var timeToRunningBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Metrics is MessageSink that serves metrics of services in the Prometheus text format:
+//
+//	services_state{service,state}               1 for the current state of the service
+//	services_restarts_total{service}            starts after the first one
+//	services_uptime_seconds{service}            time in StateRunning, zero if it is not running
+//	services_time_to_running_seconds{service}   histogram of times from StateStarted to StateRunning
+//	services_exits_total{service,code}          exits of processes by exit code
+//	services_output_lines_total{service}        output lines, use rate() for the line rate
+//	services_warnings_total{service}            warnings of failure patterns and resource thresholds
+//
+// and the usage of resources of running services if sampling is enabled, see SetResourceSampling:
+//
+//	services_cpu_cores{service}
+//	services_memory_rss_bytes{service}
+//	services_open_fds{service}
+//	services_threads{service}
+//	services_processes{service}
+type Metrics struct {
+	sm  *ServiceManager
+	now func() time.Time
+
+	mu sync.Mutex
+	// start times of services waiting for StateRunning
+	started       map[string]time.Time
+	timeToRunning map[string]*histogram
+	exits         map[string]map[int]uint64
+	lines         map[string]uint64
+	warnings      map[string]uint64
+}
+
+type histogram struct {
+	// counts of observations in buckets, not cumulative
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewMetrics(sm *ServiceManager) *Metrics {
+	return &Metrics{
+		sm:            sm,
+		now:           time.Now,
+		started:       make(map[string]time.Time),
+		timeToRunning: make(map[string]*histogram),
+		exits:         make(map[string]map[int]uint64),
+		lines:         make(map[string]uint64),
+		warnings:      make(map[string]uint64),
+	}
+}
+
+// HandleMessage counts the message
+func (m *Metrics) HandleMessage(message ServiceMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch message.Type {
+	case MessageString:
+		m.lines[message.Name]++
+		return
+	case MessageWarning:
+		m.warnings[message.Name]++
+		return
+	}
+
+	switch message.State {
+	case StateStarted:
+		m.started[message.Name] = message.Time
+	case StateRunning:
+		if started, ok := m.started[message.Name]; ok {
+			m.observe(message.Name, message.Time.Sub(started).Seconds())
+		}
+
+		delete(m.started, message.Name)
+	default:
+		delete(m.started, message.Name)
+	}
+
+	if message.Exit != nil {
+		exits, ok := m.exits[message.Name]
+		if !ok {
+			exits = make(map[int]uint64)
+			m.exits[message.Name] = exits
+		}
+
+		exits[message.Exit.Code]++
+	}
+}
+
+func (m *Metrics) observe(name string, seconds float64) {
+	h, ok := m.timeToRunning[name]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(timeToRunningBuckets))}
+		m.timeToRunning[name] = h
+	}
+
+	for i, bound := range timeToRunningBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+
+	h.sum += seconds
+	h.count++
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	_ = m.Write(w)
+}
+
+// Write writes metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) error {
+	var (
+		b      strings.Builder
+		status = m.sm.Status()
+		now    = m.now()
+	)
+
+	writeMetricHeader(&b, "services_state", "gauge", "State of the service, 1 for the current state.")
+
+	for _, service := range status {
+		for _, state := range StateValues() {
+			value := 0
+			if service.State == state {
+				value = 1
+			}
+
+			fmt.Fprintf(&b, "services_state{service=%s,state=%s} %d\n",
+				quoteLabel(service.Name), quoteLabel(stateName(state)), value)
+		}
+	}
+
+	writeMetricHeader(&b, "services_restarts_total", "counter", "Starts of the service after the first one.")
+
+	for _, service := range status {
+		fmt.Fprintf(&b, "services_restarts_total{service=%s} %d\n", quoteLabel(service.Name), service.Restarts)
+	}
+
+	writeMetricHeader(&b, "services_uptime_seconds", "gauge", "Time since the service is running, zero if it is not running.")
+
+	for _, service := range status {
+		uptime := 0.0
+		if service.State == StateRunning {
+			uptime = now.Sub(service.Since).Seconds()
+		}
+
+		fmt.Fprintf(&b, "services_uptime_seconds{service=%s} %s\n", quoteLabel(service.Name), formatFloat(uptime))
+	}
+
+	resources := []struct {
+		name  string
+		help  string
+		value func(usage *ResourceUsage) string
+	}{
+		{"services_cpu_cores", "CPU cores used by processes of the service.", func(usage *ResourceUsage) string {
+			return formatFloat(usage.CPU)
+		}},
+		{"services_memory_rss_bytes", "Resident memory of processes of the service.", func(usage *ResourceUsage) string {
+			return strconv.FormatUint(usage.RSS, 10)
+		}},
+		{"services_open_fds", "Open file descriptors of processes of the service.", func(usage *ResourceUsage) string {
+			return strconv.Itoa(usage.FDs)
+		}},
+		{"services_threads", "Threads of processes of the service.", func(usage *ResourceUsage) string {
+			return strconv.Itoa(usage.Threads)
+		}},
+		{"services_processes", "Processes of the service.", func(usage *ResourceUsage) string {
+			return strconv.Itoa(usage.Processes)
+		}},
+	}
+
+	for _, resource := range resources {
+		writeMetricHeader(&b, resource.name, "gauge", resource.help)
+
+		for _, service := range status {
+			if service.Resources != nil {
+				fmt.Fprintf(&b, "%s{service=%s} %s\n", resource.name, quoteLabel(service.Name), resource.value(service.Resources))
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeMetricHeader(&b, "services_time_to_running_seconds", "histogram", "Time from the start of the service to StateRunning.")
+
+	names := make([]string, 0, len(m.timeToRunning))
+	for name := range m.timeToRunning {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		h := m.timeToRunning[name]
+		label := quoteLabel(name)
+
+		var cumulative uint64
+		for i, bound := range timeToRunningBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "services_time_to_running_seconds_bucket{service=%s,le=%s} %d\n",
+				label, quoteLabel(formatFloat(bound)), cumulative)
+		}
+
+		fmt.Fprintf(&b, "services_time_to_running_seconds_bucket{service=%s,le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "services_time_to_running_seconds_sum{service=%s} %s\n", label, formatFloat(h.sum))
+		fmt.Fprintf(&b, "services_time_to_running_seconds_count{service=%s} %d\n", label, h.count)
+	}
+
+	writeMetricHeader(&b, "services_exits_total", "counter", "Exits of processes of the service by exit code.")
+
+	names = names[:0]
+	for name := range m.exits {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		codes := make([]int, 0, len(m.exits[name]))
+		for code := range m.exits[name] {
+			codes = append(codes, code)
+		}
+
+		sort.Ints(codes)
+
+		for _, code := range codes {
+			fmt.Fprintf(&b, "services_exits_total{service=%s,code=%s} %d\n",
+				quoteLabel(name), quoteLabel(strconv.Itoa(code)), m.exits[name][code])
+		}
+	}
+
+	writeCounters(&b, "services_output_lines_total", "Output lines of the service.", m.lines)
+	writeCounters(&b, "services_warnings_total", "Warnings of the service.", m.warnings)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// writeCounters writes the counter by service name sorted by names
+func writeCounters(b *strings.Builder, metric, help string, counters map[string]uint64) {
+	writeMetricHeader(b, metric, "counter", help)
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(b, "%s{service=%s} %d\n", metric, quoteLabel(name), counters[name])
+	}
+}
+
+func writeMetricHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// quoteLabel quotes the label value, backslashes, quotes and line feeds are escaped
+func quoteLabel(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+
+	return `"` + value + `"`
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	var (
+		m       = NewServiceManager()
+		metrics = NewMetrics(m)
+		start   = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	m.Register("api", "api", nil, nil, []string{"db"})
+	m.Register("db", "db", nil, nil, []string{})
+
+	metrics.now = func() time.Time {
+		return start.Add(10 * time.Second)
+	}
+
+	for _, message := range []ServiceMessage{
+		{Type: MessageState, State: StateStarted, Time: start},
+		{Type: MessageString, Value: "hello"},
+		{Type: MessageState, State: StateRunning, Time: start.Add(1500 * time.Millisecond)},
+		{Type: MessageString, Value: "slow"},
+		// the warning of the line is not counted as the line
+		{Type: MessageWarning, Value: "slow"},
+		{Type: MessageState, State: StateFailed, Exit: &ExitStatus{Code: 1}, Time: start.Add(3 * time.Second)},
+		{Type: MessageState, State: StateStarted, Time: start.Add(4 * time.Second)},
+		{Type: MessageState, State: StateRunning, Time: start.Add(4200 * time.Millisecond)},
+	} {
+		message.Name = "api"
+		m.recordStatus(message)
+		metrics.HandleMessage(message)
+	}
+
+	m.setResources(map[string]ResourceUsage{
+		"api": {CPU: 0.25, RSS: 4096, FDs: 5, Threads: 3, Processes: 2},
+	})
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	var b strings.Builder
+	if err := metrics.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `# HELP services_state State of the service, 1 for the current state.
+# TYPE services_state gauge
+services_state{service="api",state="dead"} 0
+services_state{service="api",state="started"} 0
+services_state{service="api",state="running"} 1
+services_state{service="api",state="finished"} 0
+services_state{service="api",state="failed"} 0
+services_state{service="api",state="stopped"} 0
+services_state{service="db",state="dead"} 1
+services_state{service="db",state="started"} 0
+services_state{service="db",state="running"} 0
+services_state{service="db",state="finished"} 0
+services_state{service="db",state="failed"} 0
+services_state{service="db",state="stopped"} 0
+# HELP services_restarts_total Starts of the service after the first one.
+# TYPE services_restarts_total counter
+services_restarts_total{service="api"} 1
+services_restarts_total{service="db"} 0
+# HELP services_uptime_seconds Time since the service is running, zero if it is not running.
+# TYPE services_uptime_seconds gauge
+services_uptime_seconds{service="api"} 5.8
+services_uptime_seconds{service="db"} 0
+# HELP services_cpu_cores CPU cores used by processes of the service.
+# TYPE services_cpu_cores gauge
+services_cpu_cores{service="api"} 0.25
+# HELP services_memory_rss_bytes Resident memory of processes of the service.
+# TYPE services_memory_rss_bytes gauge
+services_memory_rss_bytes{service="api"} 4096
+# HELP services_open_fds Open file descriptors of processes of the service.
+# TYPE services_open_fds gauge
+services_open_fds{service="api"} 5
+# HELP services_threads Threads of processes of the service.
+# TYPE services_threads gauge
+services_threads{service="api"} 3
+# HELP services_processes Processes of the service.
+# TYPE services_processes gauge
+services_processes{service="api"} 2
+# HELP services_time_to_running_seconds Time from the start of the service to StateRunning.
+# TYPE services_time_to_running_seconds histogram
+services_time_to_running_seconds_bucket{service="api",le="0.1"} 0
+services_time_to_running_seconds_bucket{service="api",le="0.25"} 1
+services_time_to_running_seconds_bucket{service="api",le="0.5"} 1
+services_time_to_running_seconds_bucket{service="api",le="1"} 1
+services_time_to_running_seconds_bucket{service="api",le="2.5"} 2
+services_time_to_running_seconds_bucket{service="api",le="5"} 2
+services_time_to_running_seconds_bucket{service="api",le="10"} 2
+services_time_to_running_seconds_bucket{service="api",le="30"} 2
+services_time_to_running_seconds_bucket{service="api",le="60"} 2
+services_time_to_running_seconds_bucket{service="api",le="120"} 2
+services_time_to_running_seconds_bucket{service="api",le="+Inf"} 2
+services_time_to_running_seconds_sum{service="api"} 1.7
+services_time_to_running_seconds_count{service="api"} 2
+# HELP services_exits_total Exits of processes of the service by exit code.
+# TYPE services_exits_total counter
+services_exits_total{service="api",code="1"} 1
+# HELP services_output_lines_total Output lines of the service.
+# TYPE services_output_lines_total counter
+services_output_lines_total{service="api"} 2
+# HELP services_warnings_total Warnings of the service.
+# TYPE services_warnings_total counter
+services_warnings_total{service="api"} 1
+`, b.String())
+}
+
+func TestQuoteLabel(t *testing.T) {
+	assert.Equal(t, `"a\\b \"c\"\nd"`, quoteLabel("a\\b \"c\"\nd"))
+}
@@ -0,0 +1,92 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/<pid>/stat, it is 100 on all supported architectures
+const clockTicks = 100
+
+// readProcesses reads stats of all processes, processes exited during the reading are skipped
+func readProcesses() (map[int]procStat, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	processes := make(map[int]procStat)
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		stat, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+
+		processes[pid] = stat
+	}
+
+	return processes, nil
+}
+
+func readProcStat(pid int) (procStat, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	// the command can contain spaces and parentheses, other fields follow the last parenthesis
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return procStat{}, fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	// fields start from the state, the third field of proc(5)
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	var ppid, utime, stime, threads, rss uint64
+
+	for index, value := range map[int]*uint64{1: &ppid, 11: &utime, 12: &stime, 17: &threads, 21: &rss} {
+		if *value, err = strconv.ParseUint(fields[index], 10, 64); err != nil {
+			return procStat{}, fmt.Errorf("invalid stat of process %d: %v", pid, err)
+		}
+	}
+
+	return procStat{
+		ppid:    int(ppid),
+		cpu:     float64(utime+stime) / clockTicks,
+		threads: int(threads),
+		rss:     rss * uint64(os.Getpagesize()),
+	}, nil
+}
+
+// countFDs returns the number of open files of the process, zero if they are not accessible
+func countFDs(pid int) int {
+	dir, err := os.Open(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0
+	}
+
+	return len(names)
+}
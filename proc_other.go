@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+func readProcesses() (map[int]procStat, error) {
+	return nil, errors.New("resource sampling is supported only on linux")
+}
+
+func countFDs(pid int) int {
+	return 0
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!illumos,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import (
+	"errors"
+)
+
+func openFilesLimit() (uint64, error) {
+	return 0, errors.New("limits are supported only on unix")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ResourceUsage is the usage of the process tree of the service, see SetResourceSampling
+type ResourceUsage struct {
+	// CPU is the number of cores used during the last sampling interval
+	CPU float64
+	// RSS is the resident memory in bytes
+	RSS uint64
+	// FDs is the number of open file descriptors
+	FDs       int
+	Threads   int
+	Processes int
+
+	// pid of the sampled root process
+	pid int
+}
+
+// ResourceThresholds are limits of ResourceUsage of the service. MessageWarning is sent
+// when the usage exceeds the limit and once again after it went back below it. Zero disables the check
+type ResourceThresholds struct {
+	CPU     float64
+	RSS     uint64
+	FDs     int
+	Threads int
+}
+
+// procStat is the part of /proc/<pid>/stat used by sampling
+type procStat struct {
+	ppid int
+	// cpu is user and system time in seconds
+	cpu     float64
+	rss     uint64
+	threads int
+}
+
+// cpuSample is the CPU time of the process tree used to calculate ResourceUsage.CPU
+type cpuSample struct {
+	pid  int
+	cpu  float64
+	time time.Time
+}
+
+// SetResourceSampling enables sampling of CPU, memory, file descriptors and threads of running services
+// from /proc every interval, see ServiceStatus.Resources and Service.ResourceThresholds.
+// You should call it before Init
+func (sm *ServiceManager) SetResourceSampling(interval time.Duration) {
+	sm.sampleInterval = interval
+}
+
+// sampleResources reads /proc and passes the usage to poll until the manager is closed
+func (sm *ServiceManager) sampleResources() {
+	ticker := time.NewTicker(sm.sampleInterval)
+	defer ticker.Stop()
+
+	previous := make(map[string]cpuSample)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-sm.closed:
+			return
+		}
+
+		processes, err := readProcesses()
+		if err != nil {
+			log.Print("Can not sample resources: ", err)
+			return
+		}
+
+		var (
+			now      = time.Now()
+			children = processChildren(processes)
+			usage    = make(map[string]ResourceUsage)
+			samples  = make(map[string]cpuSample)
+		)
+
+		for _, status := range sm.Status() {
+			if status.Pid == 0 || !isStartedState(status.State) {
+				continue
+			}
+
+			tree, cpu := processTreeUsage(status.Pid, processes, children)
+			if tree.Processes == 0 {
+				continue
+			}
+
+			if last, ok := previous[status.Name]; ok && last.pid == status.Pid && now.After(last.time) {
+				tree.CPU = (cpu - last.cpu) / now.Sub(last.time).Seconds()
+
+				// exited children take their CPU time with them
+				if tree.CPU < 0 {
+					tree.CPU = 0
+				}
+			}
+
+			samples[status.Name] = cpuSample{pid: status.Pid, cpu: cpu, time: now}
+			usage[status.Name] = tree
+		}
+
+		previous = samples
+
+		select {
+		case sm.timers <- func() { sm.applyUsage(usage) }:
+		case <-sm.closed:
+			return
+		}
+	}
+}
+
+// processChildren returns children of processes by parent pid
+func processChildren(processes map[int]procStat) map[int][]int {
+	children := make(map[int][]int)
+	for pid, stat := range processes {
+		children[stat.ppid] = append(children[stat.ppid], pid)
+	}
+
+	return children
+}
+
+// processTreeUsage sums the usage of the process and its descendants, it returns the CPU time in seconds
+func processTreeUsage(pid int, processes map[int]procStat, children map[int][]int) (ResourceUsage, float64) {
+	var (
+		usage = ResourceUsage{pid: pid}
+		cpu   float64
+		queue = []int{pid}
+	)
+
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+
+		stat, ok := processes[pid]
+		if !ok {
+			continue
+		}
+
+		usage.RSS += stat.rss
+		usage.FDs += countFDs(pid)
+		usage.Threads += stat.threads
+		usage.Processes++
+		cpu += stat.cpu
+
+		queue = append(queue, children[pid]...)
+	}
+
+	return usage, cpu
+}
+
+// applyUsage records the sampled usage and checks thresholds
+func (sm *ServiceManager) applyUsage(usage map[string]ResourceUsage) {
+	sm.setResources(usage)
+
+	for name := range sm.overThresholds {
+		if _, ok := usage[name]; !ok {
+			delete(sm.overThresholds, name)
+		}
+	}
+
+	for name, current := range usage {
+		service, ok := sm.services[name]
+		if !ok || !isStartedState(sm.states[name]) {
+			continue
+		}
+
+		sm.checkThresholds(name, current, service.ResourceThresholds)
+	}
+}
+
+func (sm *ServiceManager) checkThresholds(name string, usage ResourceUsage, thresholds ResourceThresholds) {
+	checks := []struct {
+		resource string
+		exceeded bool
+		warning  string
+	}{
+		{
+			resource: "cpu",
+			exceeded: thresholds.CPU > 0 && usage.CPU > thresholds.CPU,
+			warning:  fmt.Sprintf("CPU usage %.2f cores exceeds %.2f", usage.CPU, thresholds.CPU),
+		},
+		{
+			resource: "rss",
+			exceeded: thresholds.RSS > 0 && usage.RSS > thresholds.RSS,
+			warning:  fmt.Sprintf("memory usage %s exceeds %s", formatBytes(usage.RSS), formatBytes(thresholds.RSS)),
+		},
+		{
+			resource: "fds",
+			exceeded: thresholds.FDs > 0 && usage.FDs > thresholds.FDs,
+			warning:  fmt.Sprintf("%d open files exceed %d", usage.FDs, thresholds.FDs),
+		},
+		{
+			resource: "threads",
+			exceeded: thresholds.Threads > 0 && usage.Threads > thresholds.Threads,
+			warning:  fmt.Sprintf("%d threads exceed %d", usage.Threads, thresholds.Threads),
+		},
+	}
+
+	over, ok := sm.overThresholds[name]
+	if !ok {
+		over = make(map[string]struct{})
+		sm.overThresholds[name] = over
+	}
+
+	for _, check := range checks {
+		_, wasExceeded := over[check.resource]
+
+		switch {
+		case check.exceeded && !wasExceeded:
+			over[check.resource] = struct{}{}
+
+			sm.send(stamp(ServiceMessage{
+				Name:  name,
+				Type:  MessageWarning,
+				Value: check.warning,
+			}))
+		case !check.exceeded:
+			delete(over, check.resource)
+		}
+	}
+}
+
+// formatBytes formats the size like "1.5 MiB"
+func formatBytes(size uint64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / unit
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB"}
+
+	i := 0
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %s", value, suffixes[i])
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessTreeUsage(t *testing.T) {
+	// pids that do not exist, so open files are not counted
+	const root = 1 << 30
+
+	processes := map[int]procStat{
+		root:     {ppid: 1, cpu: 1.5, rss: 100, threads: 2},
+		root + 1: {ppid: root, cpu: 0.5, rss: 50, threads: 1},
+		root + 2: {ppid: root + 1, cpu: 0.25, rss: 10, threads: 1},
+		root + 3: {ppid: 1, cpu: 10, rss: 1000, threads: 8},
+	}
+
+	usage, cpu := processTreeUsage(root, processes, processChildren(processes))
+	assert.Equal(t, ResourceUsage{RSS: 160, Threads: 4, Processes: 3, pid: root}, usage)
+	assert.Equal(t, 2.25, cpu)
+
+	usage, _ = processTreeUsage(root+4, processes, processChildren(processes))
+	assert.Equal(t, 0, usage.Processes)
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "256.0 MiB", formatBytes(256<<20))
+	assert.Equal(t, "2048.0 TiB", formatBytes(2048<<40))
+}
+
+func TestServiceManagerResourceSampling(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource sampling requires /proc")
+	}
+
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		warnings      = []string{}
+	)
+
+	service := m.Register("A", "service", []string{"lines", "ready", "sleep", "10000"}, startTemplate, []string{})
+	service.ResourceThresholds = ResourceThresholds{RSS: 1, Threads: 1 << 20}
+	m.SetResourceSampling(20 * time.Millisecond)
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("A")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("A wasn't sampled")
+
+			break loop
+		case message := <-messages:
+			if message.Type == MessageWarning {
+				warnings = append(warnings, message.Value)
+			}
+
+			if status := m.Status(); status[0].Resources != nil && len(warnings) > 0 {
+				break loop
+			}
+		}
+	}
+
+	status := m.Status()
+
+	go func() {
+		for range messages {
+		}
+	}()
+	m.Close()
+
+	if assert.Len(t, warnings, 1) {
+		assert.True(t, strings.HasPrefix(warnings[0], "memory usage "), warnings[0])
+		assert.True(t, strings.HasSuffix(warnings[0], " exceeds 1 B"), warnings[0])
+	}
+
+	if resources := status[0].Resources; assert.NotNil(t, resources) {
+		assert.Equal(t, 1, resources.Processes)
+		assert.NotZero(t, resources.RSS)
+		assert.NotZero(t, resources.Threads)
+		assert.NotZero(t, resources.FDs)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+// ringBuffer keeps the last lines, the oldest line is overwritten when it is full
+type ringBuffer struct {
+	lines []string
+	// index of the oldest line
+	start int
+	size  int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{
+		lines: make([]string, capacity),
+	}
+}
+
+func (b *ringBuffer) push(line string) {
+	if len(b.lines) == 0 {
+		return
+	}
+
+	if b.size < len(b.lines) {
+		b.lines[(b.start+b.size)%len(b.lines)] = line
+		b.size++
+
+		return
+	}
+
+	b.lines[b.start] = line
+	b.start = (b.start + 1) % len(b.lines)
+}
+
+// last returns a copy of lines from the oldest to the newest
+func (b *ringBuffer) last() []string {
+	result := make([]string, 0, b.size)
+
+	for i := 0; i < b.size; i++ {
+		result = append(result, b.lines[(b.start+i)%len(b.lines)])
+	}
+
+	return result
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBuffer(t *testing.T) {
+	testCases := map[string]struct {
+		capacity int
+		input    []string
+		expected []string
+	}{
+		"empty": {
+			capacity: 3,
+			input:    []string{},
+			expected: []string{},
+		},
+		"zero capacity": {
+			capacity: 0,
+			input:    []string{"a", "b"},
+			expected: []string{},
+		},
+		"not full": {
+			capacity: 3,
+			input:    []string{"a", "b"},
+			expected: []string{"a", "b"},
+		},
+		"full": {
+			capacity: 3,
+			input:    []string{"a", "b", "c"},
+			expected: []string{"a", "b", "c"},
+		},
+		"overwritten": {
+			capacity: 3,
+			input:    []string{"a", "b", "c", "d", "e", "f", "g"},
+			expected: []string{"e", "f", "g"},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			b := newRingBuffer(tc.capacity)
+			for _, line := range tc.input {
+				b.push(line)
+			}
+			assert.Equal(t, tc.expected, b.last())
+		})
+	}
+}
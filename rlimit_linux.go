@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// limitsSupported means that setRlimits is implemented
+const limitsSupported = true
+
+// setRlimits sets OpenFiles and Processes limits of the process with prlimit
+func setRlimits(pid int, limits ResourceLimits) error {
+	if limits.OpenFiles > 0 {
+		if err := prlimit(pid, syscall.RLIMIT_NOFILE, limits.OpenFiles); err != nil {
+			return err
+		}
+	}
+
+	if limits.Processes > 0 {
+		if err := prlimit(pid, rlimitNproc, limits.Processes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func prlimit(pid int, resource int, value uint64) error {
+	limit := syscall.Rlimit{Cur: value, Max: value}
+
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(&limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package main
+
+// rlimitNproc is RLIMIT_NPROC of asm-generic, it is not defined by syscall
+const rlimitNproc = 6
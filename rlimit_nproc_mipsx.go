@@ -0,0 +1,8 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package main
+
+// rlimitNproc is RLIMIT_NPROC of mips, it is not defined by syscall
+const rlimitNproc = 8
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// limitsSupported means that setRlimits is implemented
+const limitsSupported = false
+
+func setRlimits(pid int, limits ResourceLimits) error {
+	return errors.New("limits are supported only on linux")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+type RollingRestartOptions struct {
+	// MaxUnavailable is the number of instances restarted at the same time, at least one
+	MaxUnavailable int
+	// ReadinessWait is the maximum time to wait for a restarted instance to reach StateRunning.
+	// The restart is aborted when it expires, zero means no limit
+	ReadinessWait time.Duration
+}
+
+type rolloutPhase int
+
+const (
+	rolloutStopping rolloutPhase = iota
+	rolloutStarting
+)
+
+// rollingRestart restarts instances of the template in batches.
+// Instances that were not restarted yet are kept when a restarted instance fails
+type rollingRestart struct {
+	options RollingRestartOptions
+	pending []string
+	current map[string]rolloutPhase
+}
+
+// RollingRestart restarts instances of the template (see Register) one by one,
+// waiting for every restarted instance to reach StateRunning before moving on.
+func (sm *ServiceManager) RollingRestart(name string, options RollingRestartOptions) error {
+	if err := sm.checkTemplate(name); err != nil {
+		return err
+	}
+
+	sm.taskChannel <- TaskMessage{
+		Name:    name,
+		Task:    TaskRollingRestart,
+		Rolling: options,
+	}
+
+	return nil
+}
+
+func (sm *ServiceManager) rollingRestart(name string, options RollingRestartOptions) {
+	if _, ok := sm.rollouts[name]; ok {
+		log.Print("Rolling restart is already in progress: ", name)
+		return
+	}
+
+	if options.MaxUnavailable < 1 {
+		options.MaxUnavailable = 1
+	}
+
+	rollout := &rollingRestart{
+		options: options,
+		current: make(map[string]rolloutPhase),
+	}
+
+	for _, instance := range sm.requirements[name] {
+		if isStartedState(sm.states[instance]) {
+			rollout.pending = append(rollout.pending, instance)
+		}
+	}
+
+	sm.rollouts[name] = rollout
+	sm.advanceRollout(name, rollout)
+}
+
+// advanceRollout stops next instances, they are started again after StateDead
+func (sm *ServiceManager) advanceRollout(name string, rollout *rollingRestart) {
+	for len(rollout.current) < rollout.options.MaxUnavailable && len(rollout.pending) > 0 {
+		instance := rollout.pending[0]
+		rollout.pending = rollout.pending[1:]
+
+		// instance was removed or stopped in the meantime
+		if !isStartedState(sm.states[instance]) {
+			continue
+		}
+
+		rollout.current[instance] = rolloutStopping
+		sm.restarts[instance] = struct{}{}
+		sm.stopService(instance)
+	}
+
+	if len(rollout.current) == 0 {
+		delete(sm.rollouts, name)
+	}
+}
+
+func (sm *ServiceManager) abortRollout(name string, reason string) {
+	log.Printf("Rolling restart of %s aborted: %s", name, reason)
+	delete(sm.rollouts, name)
+}
+
+func (sm *ServiceManager) updateRollouts(instance string, state State) {
+	for name, rollout := range sm.rollouts {
+		phase, ok := rollout.current[instance]
+		if !ok {
+			continue
+		}
+
+		switch {
+		case phase == rolloutStopping && state == StateStarted:
+			rollout.current[instance] = rolloutStarting
+
+			if wait := rollout.options.ReadinessWait; wait > 0 {
+				var (
+					name    = name
+					rollout = rollout
+				)
+
+				sm.after(wait, func() {
+					if sm.rollouts[name] == rollout && rollout.current[instance] == rolloutStarting {
+						sm.abortRollout(name, instance+" is not running after "+wait.String())
+					}
+				})
+			}
+		case phase == rolloutStarting && state == StateRunning:
+			delete(rollout.current, instance)
+			sm.advanceRollout(name, rollout)
+		case phase == rolloutStarting && !isStartedState(state):
+			sm.abortRollout(name, instance+" is "+state.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stateRecord struct {
+	Name  string
+	State State
+}
+
+func TestServiceManagerRollingRestart(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		restarting    = false
+		recorded      = []stateRecord{}
+	)
+
+	m.Register("worker@", "service", []string{"sleep", "50", "lines", "ready", "sleep", "5000"}, startTemplate, []string{})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Scale("worker@", 2)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("worker@ wasn't restarted")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			if !restarting {
+				if message.Name == "worker@" && message.State == StateRunning {
+					restarting = true
+
+					go m.RollingRestart("worker@", RollingRestartOptions{})
+				}
+
+				continue
+			}
+
+			recorded = append(recorded, stateRecord{message.Name, message.State})
+
+			if message.Name == "worker@2" && message.State == StateRunning {
+				go m.Close()
+			}
+		}
+	}
+
+	assert.Equal(t, []stateRecord{
+		{"worker@1", StateStopped},
+		{"worker@", StateStarted},
+		{"worker@1", StateStarted},
+		{"worker@1", StateRunning},
+		{"worker@", StateRunning},
+		{"worker@2", StateStopped},
+		{"worker@", StateStarted},
+		{"worker@2", StateStarted},
+		{"worker@2", StateRunning},
+		{"worker@", StateRunning},
+	}, recorded[:10])
+}
+
+func TestServiceManagerRollingRestartAbort(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	dir, err := ioutil.TempDir("", "rolling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		broken        = filepath.Join(dir, "broken")
+		restarting    = false
+		closing       = false
+		recorded      = []stateRecord{}
+	)
+
+	m.Register("worker@", "service",
+		[]string{"fail-if-exists", broken, "lines", "ready", "sleep", "5000"}, startTemplate, []string{})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Scale("worker@", 2)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("worker@ wasn't restarted")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState || closing {
+				continue
+			}
+
+			if !restarting {
+				if message.Name == "worker@" && message.State == StateRunning {
+					restarting = true
+
+					if err := ioutil.WriteFile(broken, nil, 0600); err != nil {
+						t.Fatal(err)
+					}
+
+					go m.RollingRestart("worker@", RollingRestartOptions{})
+				}
+
+				continue
+			}
+
+			if message.Name != "worker@" {
+				recorded = append(recorded, stateRecord{message.Name, message.State})
+			}
+
+			if message.Name == "worker@1" && message.State == StateFailed {
+				go func() {
+					time.Sleep(200 * time.Millisecond)
+					m.Close()
+				}()
+			}
+
+			if message.Name == "worker@2" {
+				closing = true
+			}
+		}
+	}
+
+	assert.Equal(t, []stateRecord{
+		{"worker@1", StateStopped},
+		{"worker@1", StateStarted},
+		{"worker@1", StateFailed},
+		{"worker@2", StateStopped},
+	}, recorded)
+}
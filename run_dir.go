@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNotRunning is returned when there is no running stack in the run directory
+var ErrNotRunning = errors.New("stack is not running")
+
+// runDir keeps files of the running stack:
+// services.pid with the pid of the manager, state.json with the last Status,
+// control.sock of ControlServer and logs
+type runDir struct {
+	path string
+}
+
+func (d runDir) pidPath() string {
+	return filepath.Join(d.path, "services.pid")
+}
+
+func (d runDir) statePath() string {
+	return filepath.Join(d.path, "state.json")
+}
+
+func (d runDir) logsPath() string {
+	return filepath.Join(d.path, "logs")
+}
+
+func (d runDir) socketPath() string {
+	return filepath.Join(d.path, "control.sock")
+}
+
+// daemonLogPath is the file for errors of the detached manager
+func (d runDir) daemonLogPath() string {
+	return filepath.Join(d.path, "daemon.log")
+}
+
+// lock writes the pid of the current process, it fails if another manager is running.
+// The pid file is linked from a temporary file, so it is created atomically with its content
+func (d runDir) lock() error {
+	if err := os.MkdirAll(d.path, 0755); err != nil {
+		return err
+	}
+
+	tmp := d.pidPath() + "." + strconv.Itoa(os.Getpid())
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	// the second attempt is after the pid file of the exited manager is removed
+	for attempt := 0; ; attempt++ {
+		err := os.Link(tmp, d.pidPath())
+		if !os.IsExist(err) {
+			return err
+		}
+
+		pid, err := d.pid()
+		if err == nil {
+			return fmt.Errorf("stack is already running with pid %d", pid)
+		}
+
+		if err != ErrNotRunning {
+			return err
+		}
+
+		if attempt > 0 {
+			return fmt.Errorf("can not replace the pid file %s of the exited manager", d.pidPath())
+		}
+
+		if err := os.Remove(d.pidPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+}
+
+func (d runDir) unlock() error {
+	return os.Remove(d.pidPath())
+}
+
+// pid returns the pid of the running manager or ErrNotRunning
+func (d runDir) pid() (int, error) {
+	data, err := ioutil.ReadFile(d.pidPath())
+	if os.IsNotExist(err) {
+		return 0, ErrNotRunning
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid file %s: %v", d.pidPath(), err)
+	}
+
+	if !isProcessAlive(pid) {
+		return 0, ErrNotRunning
+	}
+
+	return pid, nil
+}
+
+// writeState replaces the state file atomically
+func (d runDir) writeState(status []ServiceStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := d.statePath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, d.statePath())
+}
+
+func (d runDir) readState() ([]ServiceStatus, error) {
+	data, err := ioutil.ReadFile(d.statePath())
+	if err != nil {
+		return nil, err
+	}
+
+	var status []ServiceStatus
+
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", d.statePath(), err)
+	}
+
+	return status, nil
+}
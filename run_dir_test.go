@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDirLock(t *testing.T) {
+	path, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	dir := runDir{path: filepath.Join(path, "run")}
+
+	assert.NoError(t, dir.lock())
+	assert.EqualError(t, dir.lock(), "stack is already running with pid "+strconv.Itoa(os.Getpid()))
+	assert.NoError(t, dir.unlock())
+
+	// the pid file of the exited manager is replaced
+	if err := ioutil.WriteFile(dir.pidPath(), []byte("2147483647\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, dir.lock())
+
+	pid, err := dir.pid()
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+
+	files, err := ioutil.ReadDir(dir.path)
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 1)
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"regexp"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-//go:generate enumer -text -type MessageType,State --output service_enumer.go $GOFILE
+//go:generate enumer -text -type MessageType,State,Severity,LogFormat,FailureReason --output service_enumer.go $GOFILE
 
 type MessageType int
 
@@ -18,6 +22,8 @@ const (
 	// You should close ServiceMessage chanel after receiving StateFinished or StateFailed
 	MessageState MessageType = iota
 	MessageString
+	// Output line matched FailurePattern with SeverityWarning
+	MessageWarning
 )
 
 type ServiceMessage struct {
@@ -25,6 +31,26 @@ type ServiceMessage struct {
 	Type  MessageType
 	State State
 	Value string
+	// Seq orders messages of all services
+	Seq uint64
+	// Time of the message capture, it has the monotonic clock reading
+	Time time.Time
+	// Exit is set for StateFinished, StateFailed and StateStopped when the process has exited
+	Exit *ExitStatus
+	// Fields of the output line parsed by Service.LogFormat
+	Fields map[string]string
+	// Tail is the last output lines of the service, it is set by ServiceManager for StateFailed
+	Tail []string
+	// FailureReason is set for StateFailed
+	FailureReason FailureReason
+}
+
+// ExitStatus describes how the process exited
+type ExitStatus struct {
+	// Code is the exit code, for a process terminated by a signal it is 128 + signal number
+	Code int
+	// Signal is the signal that terminated the process, zero if the process exited by itself
+	Signal syscall.Signal
 }
 
 type State int
@@ -35,16 +61,112 @@ const (
 	StateRunning
 	StateFinished
 	StateFailed
+	// StateStopped is the state of the process exited after Stop
+	StateStopped
+)
+
+// Severity of the output line matched by FailurePattern
+type Severity int
+
+const (
+	// SeverityFatal moves the service to StateFailed and kills the process
+	SeverityFatal Severity = iota
+	// SeverityWarning sends MessageWarning
+	SeverityWarning
+)
+
+// LogFormat of the service output lines, see Service.LogFormat
+type LogFormat int
+
+const (
+	LogFormatNone LogFormat = iota
+	// LogFormatJSON parses lines as JSON objects
+	LogFormatJSON
+	// LogFormatLogfmt parses lines as key=value pairs
+	LogFormatLogfmt
+)
+
+// FailureReason tells why the service entered StateFailed
+type FailureReason int
+
+const (
+	FailureReasonNone FailureReason = iota
+	// FailureReasonStart means the process could not be started
+	FailureReasonStart
+	// FailureReasonExit means the process exited with an unsuccessful code or was killed by a signal
+	FailureReasonExit
+	// FailureReasonOutput means the output line matched FailureRegexp or a fatal FailurePattern
+	FailureReasonOutput
+	// FailureReasonOOM means a process of the service was killed by the OOM killer of its cgroup, see ResourceLimits
+	FailureReasonOOM
 )
 
+type FailurePattern struct {
+	Regexp   *regexp.Regexp
+	Severity Severity
+	// Field of the parsed line matched by Regexp, the whole line is matched if it is empty
+	Field string
+}
+
+// matchLine matches the line or its field
+func matchLine(re *regexp.Regexp, field string, line string, fields map[string]string) bool {
+	if field == "" {
+		return re.MatchString(line)
+	}
+
+	value, ok := fields[field]
+
+	return ok && re.MatchString(value)
+}
+
 var execCommand = exec.CommandContext
 
+// the last message sequence number, accessed atomically
+var messageSeq uint64
+
+// stamp sets the sequence number and the capture time of the message
+func stamp(message ServiceMessage) ServiceMessage {
+	message.Seq = atomic.AddUint64(&messageSeq, 1)
+	message.Time = time.Now()
+
+	return message
+}
+
 type Service struct {
 	Name    string
 	Args    []string
 	Command string
 	State   State
 	Err     error
+	Exit    *ExitStatus
+	// Env is appended to the environment of the process
+	Env []string
+	// Propagation is applied by ServiceManager when a requirement of the service dies
+	Propagation Propagation
+	// Group is used by ServiceManager to limit concurrent starts
+	Group string
+	// Priority orders independent services started by ServiceManager, higher starts first
+	Priority int
+	// FailureRegexp moves the service to StateFailed when an output line matches it,
+	// the line is recorded as the error
+	FailureRegexp *regexp.Regexp
+	// FailurePatterns are checked after FailureRegexp, the first matched pattern is applied
+	FailurePatterns []FailurePattern
+	// SuccessExitCodes are exit codes besides zero that move the service to StateFinished
+	SuccessExitCodes []int
+	// MaxLineLength limits output lines in bytes, DefaultMaxLineLength is used if it is zero
+	MaxLineLength int
+	// SplitLongLines splits lines longer than MaxLineLength instead of truncating them
+	SplitLongLines bool
+	// LogFormat parses output lines into ServiceMessage.Fields
+	LogFormat LogFormat
+	// RunningField is the field of the parsed line matched by the running regexp,
+	// the whole line is matched if it is empty
+	RunningField string
+	// ResourceThresholds are checked when resource sampling is enabled, see SetResourceSampling
+	ResourceThresholds ResourceThresholds
+	// Limits are applied to the started process, see ResourceLimits
+	Limits ResourceLimits
 
 	channel       chan ServiceMessage
 	runningRegexp *regexp.Regexp
@@ -52,6 +174,14 @@ type Service struct {
 	ctx           context.Context
 	cancel        context.CancelFunc
 	cmd           *exec.Cmd
+	// set by Stop, accessed atomically
+	stopping int32
+	// fatal output line matched by matchFailure, StateFailed is sent when the process exits
+	outputFailure error
+	// directory of cgroups of services, set by ServiceManager, see SetCgroupRoot
+	cgroupRoot string
+	// cgroup of the started process, nil if it was not created
+	cgroup *cgroup
 }
 
 func NewService(name string, command string, args []string, runningTemplate *regexp.Regexp) *Service {
@@ -71,20 +201,36 @@ func (s *Service) Start(ctx context.Context) chan ServiceMessage {
 
 	s.ctx = ctx
 	s.cancel = cancel
+	s.Err = nil
+	s.Exit = nil
+	s.outputFailure = nil
+	atomic.StoreInt32(&s.stopping, 0)
 
 	s.cmd = execCommand(ctx, s.Command, s.Args...)
+
+	if len(s.Env) > 0 {
+		env := s.cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+
+		s.cmd.Env = append(env, s.Env...)
+	}
+
+	s.applyLimits()
+
 	stdout, err := s.cmd.StdoutPipe()
 	// we should handle one error that can occur during initialization and started and running messages
 	s.channel = make(chan ServiceMessage, 3)
 	s.setStarted()
 
 	if err != nil {
-		s.setFailed(err)
+		s.setFailed(err, FailureReasonStart)
 		return s.channel
 	}
 
 	if err := s.cmd.Start(); err != nil {
-		s.setFailed(err)
+		s.setFailed(err, FailureReasonStart)
 		return s.channel
 	}
 
@@ -96,6 +242,13 @@ func (s *Service) Start(ctx context.Context) chan ServiceMessage {
 }
 
 func (s *Service) Stop() {
+	atomic.StoreInt32(&s.stopping, 1)
+
+	// the service was not started or its process failed to start
+	if s.cmd == nil || s.cmd.Process == nil {
+		return
+	}
+
 	//if s.State == StateStarted || s.State == StateRunning {
 	err := s.cmd.Process.Signal(os.Interrupt)
 	if err != nil {
@@ -105,88 +258,210 @@ func (s *Service) Stop() {
 	//}
 }
 
-func (s *Service) setFailed(err error) {
-	s.State = StateFailed
-	s.Err = err
-	s.channel <- ServiceMessage{
-		Name:  s.Name,
-		Type:  MessageState,
-		State: StateFailed,
-		Value: err.Error(),
-	}
+func (s *Service) send(message ServiceMessage) {
+	s.channel <- stamp(message)
+}
 
+func (s *Service) setFailed(err error, reason FailureReason) {
+	s.sendFailed(err, reason)
 	close(s.channel)
 }
 
+func (s *Service) sendFailed(err error, reason FailureReason) {
+	s.State = StateFailed
+	s.Err = err
+	s.send(ServiceMessage{
+		Name:          s.Name,
+		Type:          MessageState,
+		State:         StateFailed,
+		Value:         err.Error(),
+		Exit:          s.Exit,
+		FailureReason: reason,
+	})
+}
+
 func (s *Service) setStarted() {
 	s.State = StateStarted
-	s.channel <- ServiceMessage{
+	s.send(ServiceMessage{
 		Name:  s.Name,
 		Type:  MessageState,
 		State: StateStarted,
-	}
+	})
 
 	if s.runningRegexp == nil {
 		s.State = StateRunning
-		s.channel <- ServiceMessage{
+		s.send(ServiceMessage{
 			Name:  s.Name,
 			Type:  MessageState,
 			State: StateRunning,
-		}
+		})
 	}
 }
 
 func (s *Service) setFinished() {
 	s.State = StateFinished
-	s.channel <- ServiceMessage{
+	s.send(ServiceMessage{
 		Name:  s.Name,
 		Type:  MessageState,
 		State: StateFinished,
-	}
+		Exit:  s.Exit,
+	})
+
+	close(s.channel)
+}
+
+func (s *Service) setStopped() {
+	s.State = StateStopped
+	s.send(ServiceMessage{
+		Name:  s.Name,
+		Type:  MessageState,
+		State: StateStopped,
+		Exit:  s.Exit,
+	})
 
 	close(s.channel)
 }
 
 func (s *Service) setRunning() {
 	s.State = StateRunning
-	s.channel <- ServiceMessage{
+	s.send(ServiceMessage{
 		Name:  s.Name,
 		Type:  MessageState,
 		State: StateRunning,
-	}
+	})
 }
 
 func (s *Service) handleIncomeString(input string) {
-	if s.State == StateStarted && s.runningRegexp != nil {
-		if s.runningRegexp.MatchString(input) {
+	fields := parseFields(s.LogFormat, input)
+
+	if s.State == StateStarted && s.runningRegexp != nil && s.outputFailure == nil {
+		if matchLine(s.runningRegexp, s.RunningField, input, fields) {
 			s.setRunning()
 		}
 	}
-	s.channel <- ServiceMessage{
-		Name:  s.Name,
-		Type:  MessageString,
-		Value: input,
+	s.send(ServiceMessage{
+		Name:   s.Name,
+		Type:   MessageString,
+		Value:  input,
+		Fields: fields,
+	})
+
+	s.matchFailure(input, fields)
+}
+
+// matchFailure checks the output line with FailureRegexp and FailurePatterns.
+// The process is killed after the fatal match, StateFailed is sent when it exits,
+// so the service can not be started again while the process is running
+func (s *Service) matchFailure(input string, fields map[string]string) {
+	if s.outputFailure != nil {
+		return
 	}
+
+	pattern, ok := s.failurePattern(input, fields)
+	if !ok {
+		return
+	}
+
+	switch pattern.Severity {
+	case SeverityFatal:
+		s.outputFailure = errors.New(input)
+		s.cancel()
+	case SeverityWarning:
+		s.send(ServiceMessage{
+			Name:   s.Name,
+			Type:   MessageWarning,
+			Value:  input,
+			Fields: fields,
+		})
+	}
+}
+
+func (s *Service) failurePattern(input string, fields map[string]string) (FailurePattern, bool) {
+	if s.FailureRegexp != nil && s.FailureRegexp.MatchString(input) {
+		return FailurePattern{Regexp: s.FailureRegexp}, true
+	}
+
+	for _, pattern := range s.FailurePatterns {
+		if matchLine(pattern.Regexp, pattern.Field, input, fields) {
+			return pattern, true
+		}
+	}
+
+	return FailurePattern{}, false
 }
 
 func (s *Service) poll() {
-	scanner := bufio.NewScanner(s.output)
+	lines := newLineReader(s.output, s.MaxLineLength, s.SplitLongLines)
 
-	for scanner.Scan() {
-		s.handleIncomeString(scanner.Text())
+	for {
+		line, err := lines.ReadLine()
+		if err != nil {
+			// output errors should not fail the service
+			if err != io.EOF {
+				log.Printf("Error reading output of %s: %v", s.Name, err)
+
+				_, _ = io.Copy(ioutil.Discard, s.output)
+			}
+
+			break
+		}
+
+		s.handleIncomeString(line)
 	}
 
-	if err := scanner.Err(); err != nil {
-		s.setFailed(err)
-		return
+	err := s.cmd.Wait()
+	s.Exit = newExitStatus(s.cmd.ProcessState)
+
+	reason := FailureReasonExit
+	if s.cgroup != nil {
+		if s.cgroup.oomKilled() {
+			reason = FailureReasonOOM
+		}
+
+		s.cgroup.remove()
 	}
 
-	if err := s.cmd.Wait(); err != nil {
-		s.setFailed(err)
-		return
+	switch {
+	case s.outputFailure != nil:
+		s.setFailed(s.outputFailure, FailureReasonOutput)
+	case atomic.LoadInt32(&s.stopping) == 1:
+		s.setStopped()
+	case err == nil || s.isSuccessExit():
+		s.setFinished()
+	default:
+		s.setFailed(err, reason)
+	}
+}
+
+func (s *Service) isSuccessExit() bool {
+	if s.Exit == nil {
+		return false
+	}
+
+	for _, code := range s.SuccessExitCodes {
+		if s.Exit.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newExitStatus(state *os.ProcessState) *ExitStatus {
+	if state == nil {
+		return nil
+	}
+
+	status := &ExitStatus{
+		Code: state.ExitCode(),
+	}
+
+	if wait, ok := state.Sys().(syscall.WaitStatus); ok && wait.Signaled() {
+		status.Signal = wait.Signal()
+		status.Code = 128 + int(wait.Signal())
 	}
 
-	s.setFinished()
+	return status
 }
 
 func isStartedState(s State) bool {
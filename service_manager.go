@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"regexp"
+	"sync"
+	"time"
 )
 
-//go:generate enumer -text -type TaskType -output service_manager_enumer.go $GOFILE
+// DefaultTailSize is the number of output lines kept for every service, see SetTailSize
+const DefaultTailSize = 100
+
+// DefaultReplicaRestartDelay is the delay of starting exited instances of scaled templates, see Scale
+const DefaultReplicaRestartDelay = time.Second
+
+//go:generate enumer -text -type TaskType,Propagation -output service_manager_enumer.go $GOFILE
 
 type TaskType int
 
@@ -13,20 +23,94 @@ const (
 	TaskStart TaskType = iota
 	TaskStop
 	TaskExit
+	TaskScale
+	TaskRollingRestart
+	TaskRestart
+)
+
+// Propagation defines how a started service reacts when one of its requirements
+// enters StateFailed or StateFinished. Services stopped by the manager end in StateStopped
+// and are not propagated unless they were stopped by the propagation
+type Propagation int
+
+const (
+	// PropagationNone keeps the dependent running
+	PropagationNone Propagation = iota
+	// PropagationStop stops the dependent (BindsTo)
+	PropagationStop
+	// PropagationRestart stops the dependent and starts it again with its requirements (PartOf)
+	PropagationRestart
 )
 
 type TaskMessage struct {
 	Name string
 	Task TaskType
+	// Replicas is the number of instances for TaskScale
+	Replicas int
+	// Rolling is the options of TaskRollingRestart
+	Rolling RollingRestartOptions
+}
+
+// MessageSink receives every message sent to the output of ServiceManager.
+// HandleMessage is called in the manager goroutine before the message is sent,
+// so it should not block
+type MessageSink interface {
+	HandleMessage(message ServiceMessage)
 }
 
 type ServiceManager struct {
 	services     map[string]*Service
 	requirements map[string][]string
+	dependents   map[string][]string
 	output       chan ServiceMessage
 	merged       chan ServiceMessage
 	taskChannel  chan TaskMessage
 	states       map[string]State
+	// services waiting for StateDead to be started again
+	restarts map[string]struct{}
+	// services stopped by the manager, waiting for StateDead
+	stopping map[string]struct{}
+	// services stopped by propagation, their StateStopped is propagated to their dependents
+	propagating map[string]struct{}
+	// templates of services with instances, see instantiate
+	templates map[string]*serviceTemplate
+	// instances removed by Scale, waiting for StateDead
+	removals map[string]struct{}
+	// rolling restarts in progress by template name
+	rollouts map[string]*rollingRestart
+
+	// poll state
+	tasks     []TaskMessage
+	changed   map[string]struct{}
+	isExiting bool
+
+	// limits of services in StateStarted at the same time, zero means no limit
+	maxStarting      int
+	groupMaxStarting map[string]int
+
+	// receivers of output messages, see AddSink
+	sinks []MessageSink
+
+	// last output lines by service name, guarded by mu
+	tails    map[string]*ringBuffer
+	tailSize int
+	// snapshot of states for Status, guarded by mu
+	status map[string]*ServiceStatus
+	mu     sync.RWMutex
+
+	// interval of resource sampling, zero disables it, see SetResourceSampling
+	sampleInterval time.Duration
+	// resources of services over their thresholds, see checkThresholds
+	overThresholds map[string]map[string]struct{}
+	// see SetCgroupRoot
+	cgroupRoot string
+	// delay of starting exited instances of scaled templates, see Scale
+	replicaRestartDelay time.Duration
+
+	// functions to run in poll, see after
+	timers chan func()
+	// closed after poll exited
+	closed chan struct{}
 
 	// When poll exited
 	pollDone chan struct{}
@@ -41,28 +125,111 @@ func NewServiceManager() *ServiceManager {
 		pollDone:     make(chan struct{}),
 		taskChannel:  make(chan TaskMessage),
 		states:       make(map[string]State),
+		restarts:     make(map[string]struct{}),
+		stopping:     make(map[string]struct{}),
+		propagating:  make(map[string]struct{}),
+		templates:    make(map[string]*serviceTemplate),
+		removals:     make(map[string]struct{}),
+		rollouts:     make(map[string]*rollingRestart),
+		timers:       make(chan func()),
+		closed:       make(chan struct{}),
+		tails:        make(map[string]*ringBuffer),
+		tailSize:     DefaultTailSize,
+		status:       make(map[string]*ServiceStatus),
+
+		overThresholds: make(map[string]map[string]struct{}),
+
+		replicaRestartDelay: DefaultReplicaRestartDelay,
+
+		groupMaxStarting: make(map[string]int),
 	}
 
 	return sm
 }
 
+// Register registers the service. If the name ends with '@' the service is a template:
+// instances like name@1 are created on Start or when required by other services,
+// and %i in the command, arguments, environment and requirements is replaced with the instance name.
+// The template itself is running when all its instances are running.
 func (sm *ServiceManager) Register(name string,
 	cmd string,
 	args []string,
 	running *regexp.Regexp,
 	requirements []string,
-) {
-	sm.services[name] = NewService(name, cmd, args, running)
-	sm.requirements[name] = requirements
+) *Service {
+	service := NewService(name, cmd, args, running)
+	sm.services[name] = service
 	sm.states[name] = StateDead
+	sm.addStatus(name)
+
+	if isTemplateName(name) {
+		sm.templates[name] = &serviceTemplate{
+			requirements: requirements,
+		}
+		sm.requirements[name] = []string{}
+	} else {
+		sm.requirements[name] = requirements
+	}
+
+	sm.setRequires(name)
+
+	return service
+}
+
+// SetMaxStarting limits the number of services that are started but not running yet.
+// Leafs over the limit are started when other services reach StateRunning
+func (sm *ServiceManager) SetMaxStarting(limit int) {
+	sm.maxStarting = limit
+}
+
+// SetGroupMaxStarting limits the number of services of the group (see Service.Group)
+// that are started but not running yet
+func (sm *ServiceManager) SetGroupMaxStarting(group string, limit int) {
+	sm.groupMaxStarting[group] = limit
+}
+
+// SetTailSize sets the number of output lines kept for every service, zero disables it.
+// You should call SetTailSize before Init
+func (sm *ServiceManager) SetTailSize(size int) {
+	sm.tailSize = size
+}
+
+// Tail returns the last output lines of the last run of the service from the oldest to the newest
+func (sm *ServiceManager) Tail(name string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	tail, ok := sm.tails[name]
+	if !ok {
+		return nil
+	}
+
+	return tail.last()
+}
+
+// AddSink adds the receiver of output messages. You should call AddSink before Init
+func (sm *ServiceManager) AddSink(sink MessageSink) {
+	sm.sinks = append(sm.sinks, sink)
 }
 
 func (sm *ServiceManager) Init() (chan ServiceMessage, error) {
 	// TODO: make checks about requirements:
 	// Graph is acyclic
 	// All requirements does exists
+	for _, requirements := range sm.requirements {
+		for _, name := range requirements {
+			sm.instantiate(name)
+		}
+	}
+
+	sm.dependents = ReverseRequirements(sm.requirements)
+
 	go sm.poll()
 
+	if sm.sampleInterval > 0 {
+		go sm.sampleResources()
+	}
+
 	return sm.output, nil
 }
 
@@ -82,27 +249,70 @@ func (sm *ServiceManager) Stop(name string) {
 	}
 }
 
+// Scale keeps the number of instances of the template (see Register) equal to replicas.
+// New instances are started, extra instances are stopped and removed,
+// exited instances are started again after DefaultReplicaRestartDelay
+func (sm *ServiceManager) Scale(name string, replicas int) error {
+	if err := sm.checkTemplate(name); err != nil {
+		return err
+	}
+
+	if replicas < 0 {
+		return fmt.Errorf("invalid number of replicas %d", replicas)
+	}
+
+	sm.taskChannel <- TaskMessage{
+		Name:     name,
+		Task:     TaskScale,
+		Replicas: replicas,
+	}
+
+	return nil
+}
+
+// Restart stops the service and starts it again with its requirements, the service is started if it is not running.
+// Instances of the template are restarted one by one, see RollingRestart
+func (sm *ServiceManager) Restart(name string) {
+	sm.taskChannel <- TaskMessage{
+		Name: name,
+		Task: TaskRestart,
+	}
+}
+
 func (sm *ServiceManager) Close() {
 	sm.taskChannel <- TaskMessage{
 		Task: TaskExit,
 	}
 	<-sm.pollDone
+	close(sm.closed)
 	close(sm.output)
 	close(sm.merged)
 	close(sm.taskChannel)
 }
 
 func (sm *ServiceManager) poll() {
-	tasks := []TaskMessage{}
-	changed := make(map[string]struct{})
-	isExiting := false
+	sm.changed = make(map[string]struct{})
 loop:
 	for {
 		select {
 		case task := <-sm.taskChannel:
 			switch task.Task {
+			case TaskRestart:
+				if !sm.instantiate(task.Name) {
+					log.Print("Unknown service: ", task.Name)
+					continue loop
+				}
+
+				if sm.isExiting {
+					continue loop
+				}
 			case TaskStart:
-				if isExiting || isStartedState(sm.states[task.Name]) {
+				if !sm.instantiate(task.Name) {
+					log.Print("Unknown service: ", task.Name)
+					continue loop
+				}
+
+				if sm.isExiting || isStartedState(sm.states[task.Name]) {
 					continue loop
 				}
 			case TaskStop:
@@ -110,42 +320,151 @@ loop:
 					continue loop
 				}
 			case TaskExit:
-				isExiting = true
+				sm.isExiting = true
 				// TODO exit
+			case TaskScale, TaskRollingRestart:
+				if _, ok := sm.templates[task.Name]; !ok || sm.isExiting || task.Replicas < 0 {
+					log.Printf("Can not apply %s to service %s", task.Task, task.Name)
+					continue loop
+				}
 			}
 
-			tasks = append(tasks, task)
+			sm.tasks = append(sm.tasks, task)
 		case message := <-sm.merged:
+			if _, ok := sm.stopping[message.Name]; ok && message.Type == MessageState &&
+				(message.State == StateFailed || message.State == StateFinished) {
+				// service was stopped by the manager, it is not a failure
+				message.State = StateStopped
+				message.FailureReason = FailureReasonNone
+			}
+
+			message = sm.recordTail(message)
+
 			// ignore StateDead because it is used to check that Service channel was closed
 			if message.Type != MessageState || message.State != StateDead {
-				sm.output <- message
-			}
-			if message.Type == MessageState {
-				sm.states[message.Name] = message.State
+				sm.send(message)
 			}
 			if message.Type != MessageState {
 				continue loop
 			}
+
+			sm.setState(message.Name, message.State)
+		case timer := <-sm.timers:
+			timer()
 		}
 
-		for len(tasks) > 0 && sm.applyTask(tasks[0], changed) {
-			tasks = tasks[1:]
+		for len(sm.tasks) > 0 && sm.applyTask(sm.tasks[0], sm.changed) {
+			sm.tasks = sm.tasks[1:]
 		}
 		/*
 			if len(tasks) > 0 &&
 				tasks = tasks[1:]
 			}
 		*/
-		if len(tasks) == 0 {
-			if isExiting {
+		if len(sm.tasks) == 0 {
+			if sm.isExiting {
 				break loop
 			}
-			changed = make(map[string]struct{})
+			sm.changed = make(map[string]struct{})
 		}
 	}
 	sm.pollDone <- struct{}{}
 }
 
+// recordTail keeps output lines of the last run of the service and attaches them to StateFailed
+func (sm *ServiceManager) recordTail(message ServiceMessage) ServiceMessage {
+	if sm.tailSize <= 0 {
+		return message
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	tail, ok := sm.tails[message.Name]
+	if !ok || message.Type == MessageState && message.State == StateStarted {
+		tail = newRingBuffer(sm.tailSize)
+		sm.tails[message.Name] = tail
+	}
+
+	switch {
+	case message.Type == MessageString:
+		tail.push(message.Value)
+	case message.Type == MessageState && message.State == StateFailed:
+		message.Tail = tail.last()
+	}
+
+	return message
+}
+
+// send passes the message to sinks and output
+func (sm *ServiceManager) send(message ServiceMessage) {
+	sm.recordStatus(message)
+
+	for _, sink := range sm.sinks {
+		sink.HandleMessage(message)
+	}
+
+	sm.output <- message
+}
+
+// setState records the state received from the service and reacts on it
+func (sm *ServiceManager) setState(name string, state State) {
+	previous := sm.states[name]
+	sm.states[name] = state
+
+	switch state {
+	case StateFailed, StateFinished:
+		sm.propagate(name)
+	case StateStopped:
+		if _, ok := sm.propagating[name]; ok {
+			delete(sm.propagating, name)
+			sm.propagate(name)
+		}
+	case StateDead:
+		delete(sm.stopping, name)
+		delete(sm.propagating, name)
+
+		// the process exited by itself, the stopped one is in StateStopped
+		if previous == StateFailed || previous == StateFinished {
+			sm.restartReplica(name)
+		}
+
+		if _, ok := sm.removals[name]; ok {
+			sm.remove(name)
+			return
+		}
+
+		if _, ok := sm.restarts[name]; ok {
+			delete(sm.restarts, name)
+
+			if !sm.isExiting {
+				// service and its requirements should be scheduled again
+				for _, service := range InitOrder(name, sm.requirements) {
+					delete(sm.changed, service)
+				}
+
+				sm.tasks = append(sm.tasks, TaskMessage{
+					Name: name,
+					Task: TaskStart,
+				})
+			}
+		}
+	}
+
+	sm.updateGroups(name)
+	sm.updateRollouts(name, state)
+}
+
+// after runs the function in poll after the duration
+func (sm *ServiceManager) after(d time.Duration, timer func()) {
+	time.AfterFunc(d, func() {
+		select {
+		case sm.timers <- timer:
+		case <-sm.closed:
+		}
+	})
+}
+
 var scheduleFuncMap = map[TaskType]func(root string, states map[string]State, requirements map[string][]string) []string{
 	TaskExit: func(root string, states map[string]State, requirements map[string][]string) []string {
 		return GetEnabledLeafs(states, requirements)
@@ -155,6 +474,18 @@ var scheduleFuncMap = map[TaskType]func(root string, states map[string]State, re
 }
 
 func (sm *ServiceManager) applyTask(task TaskMessage, changed map[string]struct{}) bool {
+	switch task.Task {
+	case TaskScale:
+		sm.scale(task.Name, task.Replicas)
+		return true
+	case TaskRollingRestart:
+		sm.rollingRestart(task.Name, task.Rolling)
+		return true
+	case TaskRestart:
+		sm.restart(task.Name)
+		return true
+	}
+
 	var (
 		scheduleFunc = scheduleFuncMap[task.Task]
 		schedule     = scheduleFunc(task.Name, sm.states, sm.requirements)
@@ -165,6 +496,13 @@ func (sm *ServiceManager) applyTask(task TaskMessage, changed map[string]struct{
 		return true
 	}
 
+	if task.Task == TaskStart {
+		if name, ok := sm.failedRequirement(schedule, changed); ok {
+			log.Printf("Can not start %s: %s is %s", task.Name, name, sm.states[name])
+			return true
+		}
+	}
+
 	for _, x := range schedule {
 		if _, ok := changed[x]; !ok {
 			schedule[n] = x
@@ -178,9 +516,25 @@ func (sm *ServiceManager) applyTask(task TaskMessage, changed map[string]struct{
 
 	if task.Task == TaskStart {
 		taskFunc = sm.startService
+		priorities := make(map[string]int, len(schedule))
+
+		for _, name := range schedule {
+			priorities[name] = sm.services[name].Priority
+		}
+
+		SortByPriority(schedule, priorities)
 	}
 
 	for _, name := range schedule {
+		if task.Task == TaskStart {
+			sm.setScheduled(name, time.Now())
+		}
+
+		if task.Task == TaskStart && !sm.canStart(name) {
+			// it will be scheduled again after the next state change
+			continue
+		}
+
 		taskFunc(name)
 
 		changed[name] = struct{}{}
@@ -189,11 +543,107 @@ func (sm *ServiceManager) applyTask(task TaskMessage, changed map[string]struct{
 	return false
 }
 
+// failedRequirement returns the requirement started by the start task that is not running anymore,
+// like a requirement crashed before StateRunning. The task is dropped then, otherwise it waits for
+// the requirement forever and blocks the next tasks
+func (sm *ServiceManager) failedRequirement(schedule []string, changed map[string]struct{}) (string, bool) {
+	for _, name := range schedule {
+		if _, ok := changed[name]; ok && !isStartedState(sm.states[name]) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// canStart checks that starting the service does not exceed concurrency limits
+func (sm *ServiceManager) canStart(name string) bool {
+	var (
+		group         = sm.services[name].Group
+		starting      = 0
+		groupStarting = 0
+	)
+
+	for other, state := range sm.states {
+		if _, ok := sm.templates[other]; ok || state != StateStarted {
+			continue
+		}
+
+		starting++
+
+		if group != "" && sm.services[other].Group == group {
+			groupStarting++
+		}
+	}
+
+	if sm.maxStarting > 0 && starting >= sm.maxStarting {
+		return false
+	}
+
+	if limit := sm.groupMaxStarting[group]; group != "" && limit > 0 && groupStarting >= limit {
+		return false
+	}
+
+	return true
+}
+
+// propagate stops or restarts started dependents of the service that is not running anymore
+func (sm *ServiceManager) propagate(name string) {
+	for _, dependent := range sm.dependents[name] {
+		if _, ok := sm.templates[dependent]; ok || !isStartedState(sm.states[dependent]) {
+			continue
+		}
+
+		switch sm.services[dependent].Propagation {
+		case PropagationStop:
+			sm.stopService(dependent)
+			sm.propagating[dependent] = struct{}{}
+		case PropagationRestart:
+			sm.stopService(dependent)
+			sm.propagating[dependent] = struct{}{}
+			sm.restarts[dependent] = struct{}{}
+		}
+	}
+}
+
+// restart stops the started service and schedules its start after StateDead
+func (sm *ServiceManager) restart(name string) {
+	if _, ok := sm.templates[name]; ok {
+		sm.rollingRestart(name, RollingRestartOptions{})
+		return
+	}
+
+	if !isStartedState(sm.states[name]) {
+		sm.tasks = append(sm.tasks, TaskMessage{
+			Name: name,
+			Task: TaskStart,
+		})
+
+		return
+	}
+
+	sm.stopService(name)
+	sm.restarts[name] = struct{}{}
+}
+
 func (sm *ServiceManager) startService(name string) {
+	if template, ok := sm.templates[name]; ok {
+		template.active = true
+		sm.updateGroup(name)
+
+		return
+	}
+
 	if !isStartedState(sm.states[name]) {
-		serviceChan := sm.services[name].Start(context.TODO())
+		service := sm.services[name]
+		service.cgroupRoot = sm.cgroupRoot
+		serviceChan := service.Start(context.TODO())
 		sm.states[name] = StateStarted
 
+		if service.cmd.Process != nil {
+			sm.setPid(name, service.cmd.Process.Pid)
+		}
+
 		go func() {
 			for message := range serviceChan {
 				sm.merged <- message
@@ -208,7 +658,15 @@ func (sm *ServiceManager) startService(name string) {
 }
 
 func (sm *ServiceManager) stopService(name string) {
+	if template, ok := sm.templates[name]; ok {
+		template.active = false
+		sm.updateGroup(name)
+
+		return
+	}
+
 	if isStartedState(sm.states[name]) {
+		sm.stopping[name] = struct{}{}
 		sm.services[name].Stop()
 	}
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sync"
 	"sync/atomic"
@@ -59,8 +62,9 @@ func TestServiceManagerStart(t *testing.T) {
 			Name:  "TEST",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
-	}, recorded)
+	}, unstamped(recorded))
 }
 
 func TestServiceManagerRestart(t *testing.T) {
@@ -91,6 +95,7 @@ func TestServiceManagerRestart(t *testing.T) {
 			Name:  "TEST",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
 		{
 			Name:  "TEST",
@@ -116,6 +121,7 @@ func TestServiceManagerRestart(t *testing.T) {
 			Name:  "TEST",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
 	}
 
@@ -149,7 +155,7 @@ func TestServiceManagerRestart(t *testing.T) {
 		}
 	}
 
-	assert.Equal(t, expected, recorded)
+	assert.Equal(t, expected, unstamped(recorded))
 }
 
 func TestServiceManagerStartWithDependency(t *testing.T) {
@@ -207,8 +213,9 @@ func TestServiceManagerStartWithDependency(t *testing.T) {
 			Name:  "B",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
-	}, recorded)
+	}, unstamped(recorded))
 }
 
 func TestServiceManagerStartWithFullfilledDependency(t *testing.T) {
@@ -246,6 +253,10 @@ func TestServiceManagerStartWithFullfilledDependency(t *testing.T) {
 				if atomic.LoadInt64(&aStarts) != 1 {
 					t.Error("A started more than once!")
 				}
+			}
+
+			// B exits by itself, otherwise it could be stopped by Close
+			if message.Type == MessageState && !isStartedState(message.State) {
 				go m.Close()
 			}
 		}
@@ -271,7 +282,68 @@ func TestServiceManagerStartWithFullfilledDependency(t *testing.T) {
 			Name:  "B",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
+	}, unstamped(recorded))
+}
+
+func TestServiceManagerStartWithCrashedDependency(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		recorded      = []stateRecord{}
+	)
+
+	m.Register("A", "service", []string{"sleep", "10000"}, nil, []string{"B"})
+	m.Register("B", "service", []string{"sleep", "100", "error"}, startTemplate, []string{})
+	m.Register("C", "service", []string{"sleep", "10000"}, nil, []string{})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+
+	go func() {
+		m.Start("A")
+		// the start of A is dropped after B failed, it does not block the next task
+		m.Start("C")
+	}()
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("C wasn't started")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			recorded = append(recorded, stateRecord{Name: message.Name, State: message.State})
+
+			if message.Name == "C" && message.State == StateRunning {
+				go m.Close()
+			}
+		}
+	}
+
+	assert.Equal(t, []stateRecord{
+		{Name: "B", State: StateStarted},
+		{Name: "B", State: StateFailed},
+		{Name: "C", State: StateStarted},
+		{Name: "C", State: StateRunning},
+		{Name: "C", State: StateStopped},
 	}, recorded)
 }
 
@@ -310,7 +382,7 @@ loop:
 
 				go m.Close()
 			}
-			if message.Type == MessageState && message.State == StateFinished {
+			if message.Type == MessageState && message.State == StateStopped {
 				go m.Close()
 			}
 		}
@@ -360,7 +432,7 @@ loop:
 					t.Error("aService wasn't stopped gracefully")
 				}
 
-				if message.Type == MessageState && message.State == StateFinished {
+				if message.Type == MessageState && message.State == StateStopped {
 					atomic.AddInt64(&aStops, 1)
 				}
 			case "B":
@@ -372,9 +444,9 @@ loop:
 					t.Error("bService wasn't stopped gracefully")
 				}
 
-				if message.Type == MessageState && message.State == StateFinished {
-					assert.Equal(t, 1, atomic.LoadInt64(&aStarts), "a wasn't started or was started more than once")
-					assert.Equal(t, 1, atomic.LoadInt64(&aStops), "a wasn't stopped or was stopped more than once")
+				if message.Type == MessageState && message.State == StateStopped {
+					assert.Equal(t, int64(1), atomic.LoadInt64(&aStarts), "a wasn't started or was started more than once")
+					assert.Equal(t, int64(1), atomic.LoadInt64(&aStops), "a wasn't stopped or was stopped more than once")
 
 					go m.Close()
 				}
@@ -429,7 +501,7 @@ func TestServiceManagerClose(t *testing.T) {
 				started.Done()
 			}
 
-			if message.Type == MessageState && message.State == StateFinished {
+			if message.Type == MessageState && message.State == StateStopped {
 				atomic.AddInt64(&finishes, 1)
 			}
 		}
@@ -447,3 +519,581 @@ func TestServiceManagerClose(t *testing.T) {
 		t.Errorf("Finished must be 3, actual: %d", finishes)
 	}
 }
+
+func TestServiceManagerPropagationStop(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		recorded      = []State{}
+	)
+
+	m.Register("A", "service", []string{"lines", "ready", "sleep", "200", "error"}, startTemplate, []string{})
+	m.Register("B", "service", []string{"sleep", "10000"}, nil, []string{"A"}).Propagation = PropagationStop
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("B")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("B wasn't stopped after A failed")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Name == "B" && message.Type == MessageState {
+				recorded = append(recorded, message.State)
+
+				if !isStartedState(message.State) {
+					go m.Close()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, []State{StateStarted, StateRunning, StateStopped}, recorded)
+}
+
+func TestServiceManagerPropagationChain(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		recorded      = map[string][]State{}
+	)
+
+	m.Register("C", "service", []string{"lines", "ready", "sleep", "200", "error"}, startTemplate, []string{})
+	m.Register("B", "service", []string{"sleep", "10000"}, nil, []string{"C"}).Propagation = PropagationStop
+	m.Register("A", "service", []string{"sleep", "10000"}, nil, []string{"B"}).Propagation = PropagationStop
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("A")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("A wasn't stopped after C failed")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			recorded[message.Name] = append(recorded[message.Name], message.State)
+
+			if message.Name == "A" && !isStartedState(message.State) {
+				go m.Close()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string][]State{
+		"A": {StateStarted, StateRunning, StateStopped},
+		"B": {StateStarted, StateRunning, StateStopped},
+		"C": {StateStarted, StateRunning, StateFailed},
+	}, recorded)
+}
+
+func TestServiceManagerPropagationRestart(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		aStarts       = 0
+		bStarts       = 0
+	)
+
+	m.Register("A", "service", []string{"lines", "ready", "sleep", "200", "error"}, startTemplate, []string{})
+	m.Register("B", "service", []string{"sleep", "10000"}, nil, []string{"A"}).Propagation = PropagationRestart
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("B")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("B wasn't restarted after A failed")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState || message.State != StateStarted {
+				continue
+			}
+
+			switch message.Name {
+			case "A":
+				aStarts++
+			case "B":
+				bStarts++
+
+				if bStarts == 2 {
+					go m.Close()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, 2, aStarts)
+	assert.Equal(t, 2, bStarts)
+}
+
+// maxStarting starts root and returns the maximum number of filtered services
+// that were started but not running at the same time
+func maxStarting(t *testing.T, m *ServiceManager, root string, filter func(name string) bool) int {
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	var (
+		ticker   = time.NewTicker(5 * time.Second)
+		starting = map[string]struct{}{}
+		max      = 0
+	)
+
+	defer ticker.Stop()
+	m.Start(root)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Errorf("%s wasn't started", root)
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			if message.Name == root && message.State == StateRunning {
+				go m.Close()
+			}
+
+			if !filter(message.Name) {
+				continue
+			}
+
+			if message.State == StateStarted {
+				starting[message.Name] = struct{}{}
+			} else {
+				delete(starting, message.Name)
+			}
+
+			if len(starting) > max {
+				max = len(starting)
+			}
+		}
+	}
+
+	return max
+}
+
+func TestServiceManagerMaxStarting(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		startTemplate = regexp.MustCompile("ready")
+	)
+
+	for _, name := range []string{"A", "B", "C"} {
+		m.Register(name, "service", []string{"sleep", "50", "lines", "ready", "sleep", "5000"}, startTemplate, []string{})
+	}
+
+	m.Register("D", "service", []string{"sleep", "5000"}, nil, []string{"A", "B", "C"})
+	m.SetMaxStarting(1)
+
+	assert.Equal(t, 1, maxStarting(t, m, "D", func(name string) bool {
+		return true
+	}))
+}
+
+func TestServiceManagerGroupMaxStarting(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		startTemplate = regexp.MustCompile("ready")
+	)
+
+	for _, name := range []string{"A", "B", "C"} {
+		m.Register(name, "service", []string{"sleep", "50", "lines", "ready", "sleep", "5000"}, startTemplate, []string{}).Group = "jvm"
+	}
+
+	m.Register("D", "service", []string{"sleep", "50", "lines", "ready", "sleep", "5000"}, startTemplate, []string{})
+	m.Register("E", "service", []string{"sleep", "5000"}, nil, []string{"A", "B", "C", "D"})
+	m.SetGroupMaxStarting("jvm", 2)
+
+	assert.Equal(t, 2, maxStarting(t, m, "E", func(name string) bool {
+		return m.services[name].Group == "jvm"
+	}))
+}
+
+func TestServiceManagerPriority(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		startTemplate = regexp.MustCompile("ready")
+		priorities    = map[string]int{"A": 0, "B": 5, "C": 10}
+		recorded      = []string{}
+	)
+
+	for name, priority := range priorities {
+		m.Register(name, "service", []string{"lines", "ready", "sleep", "5000"}, startTemplate, []string{}).Priority = priority
+	}
+
+	m.Register("D", "service", []string{"sleep", "5000"}, nil, []string{"A", "B", "C"})
+	m.SetMaxStarting(1)
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	m.Start("D")
+
+	for message := range messages {
+		if message.Type != MessageState || message.State != StateStarted {
+			continue
+		}
+
+		recorded = append(recorded, message.Name)
+
+		if message.Name == "D" {
+			go m.Close()
+		}
+	}
+
+	assert.Equal(t, []string{"C", "B", "A", "D"}, recorded)
+}
+
+func TestServiceManagerStopIsNotFailure(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		aStates       = []ServiceMessage{}
+		bStarts       = 0
+	)
+
+	m.Register("A", "service", []string{"fail-on-interrupt", "lines", "ready", "sleep", "10000"},
+		startTemplate, []string{}).FailureRegexp = regexp.MustCompile("^FATAL")
+	m.Register("B", "service", []string{"sleep", "10000"}, nil, []string{"A"}).Propagation = PropagationRestart
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("B")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("A wasn't stopped")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			switch message.Name {
+			case "A":
+				if !isStartedState(message.State) {
+					// the process exits by itself or is killed after the fatal line
+					message.Exit = nil
+					aStates = append(aStates, message)
+
+					go func() {
+						time.Sleep(100 * time.Millisecond)
+						m.Close()
+					}()
+				}
+			case "B":
+				if message.State == StateStarted {
+					bStarts++
+				}
+
+				if message.State == StateRunning {
+					go m.Stop("A")
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, []ServiceMessage{
+		{
+			Name:  "A",
+			Type:  MessageState,
+			State: StateStopped,
+			Value: "FATAL: interrupted",
+		},
+	}, unstamped(aStates))
+	assert.Equal(t, 1, bStarts)
+}
+
+func TestServiceManagerRestartFailedByOutput(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	m := NewServiceManager()
+	m.Register("A", "service", []string{"lines", "ready,FATAL: broken", "sleep", "10000"},
+		regexp.MustCompile("ready"), []string{}).FailureRegexp = regexp.MustCompile("^FATAL")
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	go m.Start("A")
+
+	states := []State{}
+
+	for message := range messages {
+		if message.Type != MessageState {
+			continue
+		}
+
+		states = append(states, message.State)
+
+		if message.State == StateFailed {
+			if len(states) > 3 {
+				go m.Close()
+			} else {
+				go m.Restart("A")
+			}
+		}
+	}
+
+	assert.Equal(t, []State{
+		StateStarted, StateRunning, StateFailed, StateStarted, StateRunning, StateFailed,
+	}, states)
+}
+
+func TestServiceManagerTail(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m      = NewServiceManager()
+		ticker = time.NewTicker(5 * time.Second)
+		failed *ServiceMessage
+	)
+
+	m.Register("A", "service", []string{"lines", "one,two,three", "error"}, nil, []string{})
+	m.SetTailSize(2)
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("A")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("A wasn't failed")
+
+			break loop
+		case message := <-messages:
+			if message.Type == MessageState && message.State == StateFailed {
+				failed = &message
+
+				break loop
+			}
+		}
+	}
+
+	go func() {
+		for range messages {
+		}
+	}()
+	m.Close()
+
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, []string{"two", "three"}, failed.Tail)
+	}
+	assert.Equal(t, []string{"two", "three"}, m.Tail("A"))
+	assert.Nil(t, m.Tail("B"))
+}
+
+func TestServiceManagerTailOfLastRun(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		m      = NewServiceManager()
+		ticker = time.NewTicker(5 * time.Second)
+		second = filepath.Join(dir, "second")
+		failed = [][]string{}
+	)
+
+	// the first run prints one, two and three, the second one prints one and two
+	m.Register("A", "service",
+		[]string{"lines", "one,two", "fail-if-exists", second, "lines", "three", "error"}, nil, []string{})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("A")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("A wasn't failed twice")
+
+			break loop
+		case message := <-messages:
+			if message.Type != MessageState || message.State != StateFailed {
+				continue
+			}
+
+			failed = append(failed, message.Tail)
+			if len(failed) == 2 {
+				break loop
+			}
+
+			if err := ioutil.WriteFile(second, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			go m.Start("A")
+		}
+	}
+
+	go func() {
+		for range messages {
+		}
+	}()
+	m.Close()
+
+	assert.Equal(t, [][]string{{"one", "two", "three"}, {"one", "two"}}, failed)
+	assert.Equal(t, []string{"one", "two"}, m.Tail("A"))
+}
+
+func TestServiceManagerRestartTask(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		states        = []State{}
+	)
+
+	m.Register("A", "service", []string{"lines", "ready", "sleep", "10000"}, startTemplate, []string{})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Start("A")
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("A wasn't restarted")
+
+			break loop
+		case message := <-messages:
+			if message.Type != MessageState {
+				continue
+			}
+
+			states = append(states, message.State)
+
+			if message.State == StateRunning {
+				if len(states) > 2 {
+					break loop
+				}
+
+				go m.Restart("A")
+			}
+		}
+	}
+
+	status := m.Status()
+
+	go func() {
+		for range messages {
+		}
+	}()
+	m.Close()
+
+	assert.Equal(t, []State{
+		StateStarted, StateRunning, StateStopped, StateStarted, StateRunning,
+	}, states)
+
+	if assert.Len(t, status, 1) {
+		assert.Equal(t, "A", status[0].Name)
+		assert.Equal(t, StateRunning, status[0].State)
+		assert.Equal(t, 1, status[0].Restarts)
+		assert.NotZero(t, status[0].Pid)
+		assert.False(t, status[0].Since.IsZero())
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// serviceTemplate is a service registered with the name ending with '@'.
+// Its instances are registered as requirements of the template,
+// so the template is a virtual service which state is aggregated from the instances
+type serviceTemplate struct {
+	// requirements of every instance, %i is replaced with the instance name
+	requirements []string
+	// template was started or stopped as a service
+	active bool
+	// number of running instances required for the template to be running, zero means all
+	minReady int
+	// number of instances kept by Scale, zero if the template was not scaled
+	replicas int
+}
+
+func isTemplateName(name string) bool {
+	return strings.HasSuffix(name, "@")
+}
+
+// splitInstanceName splits "worker@3" to "worker@" and "3"
+func splitInstanceName(name string) (template, instance string) {
+	i := strings.IndexByte(name, '@')
+	if i < 0 {
+		return "", ""
+	}
+
+	return name[:i+1], name[i+1:]
+}
+
+func replaceInstance(values []string, instance string) []string {
+	if values == nil {
+		return nil
+	}
+
+	replaced := make([]string, 0, len(values))
+
+	for _, value := range values {
+		replaced = append(replaced, strings.ReplaceAll(value, "%i", instance))
+	}
+
+	return replaced
+}
+
+// instance returns a copy of the template service with %i replaced by the instance name
+func (s *Service) instance(name, instance string) *Service {
+	service := *s
+	service.Name = name
+	service.Command = strings.ReplaceAll(s.Command, "%i", instance)
+	service.Args = replaceInstance(s.Args, instance)
+	service.Env = replaceInstance(s.Env, instance)
+
+	return &service
+}
+
+// instantiate registers the instance of the template if the service is not registered yet.
+// It returns false if there is no such service or template
+func (sm *ServiceManager) instantiate(name string) bool {
+	if _, ok := sm.services[name]; ok {
+		return true
+	}
+
+	templateName, instance := splitInstanceName(name)
+
+	template, ok := sm.templates[templateName]
+	if !ok || instance == "" {
+		return false
+	}
+
+	requirements := replaceInstance(template.requirements, instance)
+
+	for _, requirement := range requirements {
+		sm.instantiate(requirement)
+	}
+
+	sm.services[name] = sm.services[templateName].instance(name, instance)
+	sm.requirements[name] = requirements
+	sm.states[name] = StateDead
+	sm.addStatus(name)
+	sm.requirements[templateName] = append(sm.requirements[templateName], name)
+	sm.setRequires(name)
+	sm.setRequires(templateName)
+
+	// dependents are calculated in Init for services that exist before it
+	if sm.dependents != nil {
+		for _, requirement := range requirements {
+			sm.dependents[requirement] = append(sm.dependents[requirement], name)
+		}
+
+		sm.dependents[name] = append(sm.dependents[name], templateName)
+	}
+
+	return true
+}
+
+// SetMinReady sets the number of running instances required for the template to be in StateRunning.
+// By default and if ready is zero all instances should be running. You should call SetMinReady before Init
+func (sm *ServiceManager) SetMinReady(name string, ready int) error {
+	template, ok := sm.templates[name]
+	if !ok {
+		return fmt.Errorf("%s is not a template", name)
+	}
+
+	if ready < 0 {
+		return fmt.Errorf("invalid number of ready instances %d", ready)
+	}
+
+	template.minReady = ready
+
+	return nil
+}
+
+// checkTemplate checks that the template is registered. It is safe to call it from any goroutine
+func (sm *ServiceManager) checkTemplate(name string) error {
+	if !isTemplateName(name) || !sm.hasService(name) {
+		return fmt.Errorf("%s is not a template", name)
+	}
+
+	return nil
+}
+
+// restartReplica starts the exited instance of the scaled template again after the delay
+func (sm *ServiceManager) restartReplica(name string) {
+	templateName, instance := splitInstanceName(name)
+
+	template, ok := sm.templates[templateName]
+	if !ok || instance == "" || template.replicas == 0 || sm.isExiting {
+		return
+	}
+
+	sm.after(sm.replicaRestartDelay, func() {
+		// the instance was removed or started in the meantime
+		if _, ok := sm.services[name]; !ok || sm.isExiting || sm.states[name] != StateDead {
+			return
+		}
+
+		log.Printf("Starting the exited instance %s", name)
+
+		delete(sm.changed, name)
+		sm.tasks = append(sm.tasks, TaskMessage{
+			Name: name,
+			Task: TaskStart,
+		})
+	})
+}
+
+// scale instantiates or removes instances of the template.
+// Instances get the smallest free numbers, the latest instances are removed first
+func (sm *ServiceManager) scale(name string, replicas int) {
+	sm.templates[name].replicas = replicas
+	instances := sm.requirements[name]
+
+	for i := 1; len(instances) < replicas; i++ {
+		instance := name + strconv.Itoa(i)
+		if _, ok := sm.services[instance]; ok {
+			continue
+		}
+
+		sm.instantiate(instance)
+		instances = sm.requirements[name]
+	}
+
+	for len(instances) > replicas {
+		instance := instances[len(instances)-1]
+		instances = instances[:len(instances)-1]
+		sm.requirements[name] = instances
+		sm.dependents[instance] = removeName(sm.dependents[instance], name)
+
+		if isStartedState(sm.states[instance]) {
+			sm.removals[instance] = struct{}{}
+			sm.stopService(instance)
+		} else {
+			sm.remove(instance)
+		}
+	}
+
+	sm.setRequires(name)
+	sm.updateGroup(name)
+
+	for _, instance := range instances {
+		if isStartedState(sm.states[instance]) {
+			continue
+		}
+
+		delete(sm.changed, instance)
+		sm.tasks = append(sm.tasks, TaskMessage{
+			Name: instance,
+			Task: TaskStart,
+		})
+	}
+}
+
+// remove unregisters the stopped instance
+func (sm *ServiceManager) remove(name string) {
+	delete(sm.removals, name)
+
+	for _, requirement := range sm.requirements[name] {
+		sm.dependents[requirement] = removeName(sm.dependents[requirement], name)
+	}
+
+	delete(sm.services, name)
+	delete(sm.requirements, name)
+	delete(sm.dependents, name)
+	delete(sm.states, name)
+	sm.removeStatus(name)
+}
+
+func removeName(names []string, name string) []string {
+	result := names[:0]
+
+	for _, other := range names {
+		if other != name {
+			result = append(result, other)
+		}
+	}
+
+	return result
+}
+
+// updateGroups updates states of templates the service is an instance of
+func (sm *ServiceManager) updateGroups(name string) {
+	for _, dependent := range sm.dependents[name] {
+		if _, ok := sm.templates[dependent]; ok {
+			sm.updateGroup(dependent)
+		}
+	}
+}
+
+func (sm *ServiceManager) updateGroup(name string) {
+	state := sm.groupState(name)
+	if state == sm.states[name] {
+		return
+	}
+
+	if state != StateDead {
+		sm.send(stamp(ServiceMessage{
+			Name:  name,
+			Type:  MessageState,
+			State: state,
+		}))
+	}
+
+	sm.setState(name, state)
+}
+
+// groupState aggregates states of the template instances
+func (sm *ServiceManager) groupState(name string) State {
+	var (
+		instances = sm.requirements[name]
+		template  = sm.templates[name]
+		counts    = make(map[State]int)
+		minReady  = len(instances)
+	)
+
+	for _, instance := range instances {
+		counts[sm.states[instance]]++
+	}
+
+	if template.minReady > 0 && template.minReady < minReady {
+		minReady = template.minReady
+	}
+
+	switch {
+	case len(instances) == 0 && template.active:
+		return StateRunning
+	case len(instances) > 0 && counts[StateRunning] >= minReady:
+		return StateRunning
+	case counts[StateStarted]+counts[StateRunning] > 0:
+		return StateStarted
+	case counts[StateFailed] > 0:
+		return StateFailed
+	case counts[StateFinished] > 0:
+		return StateFinished
+	case counts[StateStopped] > 0:
+		return StateStopped
+	default:
+		return StateDead
+	}
+}
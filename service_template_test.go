@@ -0,0 +1,274 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitInstanceName(t *testing.T) {
+	testCases := map[string]struct {
+		name     string
+		template string
+		instance string
+	}{
+		"service": {
+			name:     "worker",
+			template: "",
+			instance: "",
+		},
+		"template": {
+			name:     "worker@",
+			template: "worker@",
+			instance: "",
+		},
+		"instance": {
+			name:     "worker@3",
+			template: "worker@",
+			instance: "3",
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			template, instance := splitInstanceName(tc.name)
+			assert.Equal(t, tc.template, template)
+			assert.Equal(t, tc.instance, instance)
+		})
+	}
+}
+
+func TestServiceInstance(t *testing.T) {
+	template := NewService("worker@", "worker-%i", []string{"--queue", "q%i"}, nil)
+	template.Env = []string{"QUEUE=q%i"}
+	template.Priority = 3
+
+	service := template.instance("worker@2", "2")
+
+	assert.Equal(t, "worker@2", service.Name)
+	assert.Equal(t, "worker-2", service.Command)
+	assert.Equal(t, []string{"--queue", "q2"}, service.Args)
+	assert.Equal(t, []string{"QUEUE=q2"}, service.Env)
+	assert.Equal(t, 3, service.Priority)
+	assert.Equal(t, []string{"--queue", "q%i"}, template.Args)
+}
+
+func TestServiceManagerTemplate(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		lines         = []string{}
+		started       = []string{}
+	)
+
+	m.Register("worker@", "service",
+		[]string{"lines", "worker-%i", "env", "QUEUE", "lines", "ready", "sleep", "5000"},
+		startTemplate, []string{}).Env = []string{"QUEUE=queue-%i"}
+	m.Register("D", "service", []string{"sleep", "5000"}, nil, []string{"worker@2", "worker@"})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+
+	go func() {
+		m.Start("worker@1")
+		m.Start("D")
+	}()
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("D wasn't started")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type == MessageString && message.Name == "worker@1" {
+				lines = append(lines, message.Value)
+			}
+
+			if message.Type == MessageState && message.State == StateRunning {
+				started = append(started, message.Name)
+
+				if message.Name == "D" {
+					go m.Close()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"worker-1", "queue-1", "ready"}, lines)
+	assert.ElementsMatch(t, []string{"worker@1", "worker@2", "worker@", "D"}, started)
+	assert.Equal(t, []string{"worker@", "D"}, started[2:])
+}
+
+func TestServiceManagerScale(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m             = NewServiceManager()
+		ticker        = time.NewTicker(5 * time.Second)
+		startTemplate = regexp.MustCompile("ready")
+		running       = []string{}
+		stopped       = []string{}
+	)
+
+	m.Register("worker@", "service", []string{"sleep", "%i00", "lines", "ready", "sleep", "5000"}, startTemplate, []string{})
+	m.SetMinReady("worker@", 2)
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Scale("worker@", 3)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("worker@ wasn't scaled")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState {
+				continue
+			}
+
+			switch message.State {
+			case StateRunning:
+				running = append(running, message.Name)
+
+				if message.Name == "worker@3" {
+					go m.Scale("worker@", 1)
+				}
+			case StateStopped:
+				stopped = append(stopped, message.Name)
+
+				if len(stopped) == 2 {
+					go m.Close()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"worker@1", "worker@2", "worker@", "worker@3"}, running)
+	assert.ElementsMatch(t, []string{"worker@2", "worker@3"}, stopped[:2])
+	assert.Equal(t, []string{"worker@1"}, m.requirements["worker@"])
+	assert.NotContains(t, m.services, "worker@3")
+
+	status := m.Status()
+	if assert.Len(t, status, 2) {
+		assert.Equal(t, "worker@", status[0].Name)
+		assert.Equal(t, []string{"worker@1"}, status[0].Requires)
+	}
+}
+
+func TestServiceManagerScaleErrors(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	m := NewServiceManager()
+	m.Register("worker@", "service", []string{"sleep", "5000"}, nil, []string{})
+	m.Register("A", "service", []string{"sleep", "5000"}, nil, []string{})
+
+	assert.Error(t, m.SetMinReady("worker@", -1))
+	assert.Error(t, m.SetMinReady("A", 1))
+	assert.NoError(t, m.SetMinReady("worker@", 1))
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	go func() {
+		assert.Error(t, m.Scale("worker@", -1))
+		assert.Error(t, m.Scale("A", 1))
+		assert.Error(t, m.Scale("unknown@", 1))
+		assert.Error(t, m.RollingRestart("A", RollingRestartOptions{}))
+		assert.NoError(t, m.Scale("worker@", 1))
+	}()
+
+	running := []string{}
+
+	for message := range messages {
+		if message.Type == MessageState && message.State == StateRunning {
+			running = append(running, message.Name)
+
+			if message.Name == "worker@" {
+				go m.Close()
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"worker@1", "worker@"}, running)
+}
+
+func TestServiceManagerScaleRestartsCrashed(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	var (
+		m        = NewServiceManager()
+		ticker   = time.NewTicker(5 * time.Second)
+		recorded = []stateRecord{}
+	)
+
+	m.Register("worker@", "service", []string{"sleep", "100", "error"}, nil, []string{})
+	m.replicaRestartDelay = 10 * time.Millisecond
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal("can not init service manager: ", err)
+	}
+
+	defer ticker.Stop()
+	m.Scale("worker@", 1)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			t.Error("worker@1 wasn't restarted")
+
+			break loop
+		case message, ok := <-messages:
+			if !ok {
+				break loop
+			}
+
+			if message.Type != MessageState || message.Name != "worker@1" {
+				continue
+			}
+
+			recorded = append(recorded, stateRecord{message.Name, message.State})
+
+			if len(recorded) == 4 {
+				go m.Close()
+			}
+		}
+	}
+
+	assert.Equal(t, []stateRecord{
+		{"worker@1", StateStarted},
+		{"worker@1", StateRunning},
+		{"worker@1", StateFailed},
+		{"worker@1", StateStarted},
+	}, recorded[:4])
+}
@@ -9,12 +9,17 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// set by fail-on-interrupt
+var failOnInterrupt int32
+
 const (
 	normal = iota
 	noCommand
@@ -50,6 +55,19 @@ func setHelperCommand(t *testing.T) func() {
 	}
 }
 
+// unstamped clears sequence numbers and times of the messages to compare them
+func unstamped(messages []ServiceMessage) []ServiceMessage {
+	result := make([]ServiceMessage, 0, len(messages))
+
+	for _, message := range messages {
+		message.Seq = 0
+		message.Time = time.Time{}
+		result = append(result, message)
+	}
+
+	return result
+}
+
 func execService(args []string) {
 	for len(args) > 0 {
 		command := args[0]
@@ -80,8 +98,57 @@ func execService(args []string) {
 
 			args = args[1:]
 
+		case "env":
+			if len(args) == 0 {
+				fmt.Println("No argument")
+				os.Exit(invalidArgument)
+			}
+
+			fmt.Println(os.Getenv(args[0]))
+			args = args[1:]
+		case "fail-if-exists":
+			if len(args) == 0 {
+				fmt.Println("No argument")
+				os.Exit(invalidArgument)
+			}
+
+			if _, err := os.Stat(args[0]); err == nil {
+				os.Exit(unexpectedError)
+			}
+
+			args = args[1:]
+		case "long":
+			if len(args) == 0 {
+				fmt.Println("No argument")
+				os.Exit(invalidArgument)
+			}
+
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				fmt.Println("Argument to long must be number!")
+				os.Exit(invalidArgument)
+			}
+
+			fmt.Println(strings.Repeat("x", n))
+
+			args = args[1:]
+		case "nofile":
+			limit, err := openFilesLimit()
+			if err != nil {
+				os.Exit(unexpectedError)
+			}
+
+			fmt.Println(limit)
 		case "error":
 			os.Exit(unexpectedError)
+		case "fail-on-interrupt":
+			atomic.StoreInt32(&failOnInterrupt, 1)
+		case "terminate":
+			if err := signalProcess(os.Getpid(), syscall.SIGTERM); err != nil {
+				os.Exit(unexpectedError)
+			}
+
+			time.Sleep(time.Second)
 		}
 	}
 }
@@ -97,6 +164,11 @@ func TestHelperService(t *testing.T) {
 
 	go func() {
 		for range c {
+			if atomic.LoadInt32(&failOnInterrupt) == 1 {
+				fmt.Println("FATAL: interrupted")
+				os.Exit(unexpectedError)
+			}
+
 			os.Exit(normal)
 		}
 	}()
@@ -155,8 +227,9 @@ func TestServiceStartSimple(t *testing.T) {
 			Name:  "SIMPLE",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
-	}, recorded)
+	}, unstamped(recorded))
 }
 func TestServiceStartError(t *testing.T) {
 	defer setHelperCommand(t)()
@@ -185,8 +258,23 @@ func TestServiceStartError(t *testing.T) {
 			Type:  MessageState,
 			State: StateFailed,
 			Value: "exit status 10",
+			Exit: &ExitStatus{
+				Code: unexpectedError,
+			},
+			FailureReason: FailureReasonExit,
 		},
-	}, recorded)
+	}, unstamped(recorded))
+}
+
+func TestServiceStopNotStarted(t *testing.T) {
+	service := NewService("MISSING", "/nonexistent/service", nil, nil)
+
+	assert.NotPanics(t, service.Stop)
+
+	for range service.Start(context.TODO()) {
+	}
+
+	assert.NotPanics(t, service.Stop)
 }
 
 func TestServiceStartedRunningFinished(t *testing.T) {
@@ -231,8 +319,9 @@ func TestServiceStartedRunningFinished(t *testing.T) {
 			Name:  "CAT",
 			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
-	}, recorded)
+	}, unstamped(recorded))
 }
 func TestServiceStop(t *testing.T) {
 	defer setHelperCommand(t)()
@@ -273,7 +362,297 @@ func TestServiceStop(t *testing.T) {
 		{
 			Name:  "ERROR",
 			Type:  MessageState,
+			State: StateStopped,
+			Exit:  &ExitStatus{},
+		},
+	}, unstamped(recorded))
+}
+
+func TestServiceFailureRegexp(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	service := NewService("FATAL", "service", []string{"lines", "hello,FATAL: broken", "sleep", "10000"}, nil)
+	service.FailureRegexp = regexp.MustCompile("^FATAL")
+	messages := service.Start(context.TODO())
+	recorded := []ServiceMessage{}
+
+	for message := range messages {
+		recorded = append(recorded, message)
+	}
+
+	assert.Equal(t, []ServiceMessage{
+		{
+			Name:  "FATAL",
+			Type:  MessageState,
+			State: StateStarted,
+		},
+		{
+			Name:  "FATAL",
+			Type:  MessageState,
+			State: StateRunning,
+		},
+		{
+			Name:  "FATAL",
+			Type:  MessageString,
+			Value: "hello",
+		},
+		{
+			Name:  "FATAL",
+			Type:  MessageString,
+			Value: "FATAL: broken",
+		},
+		{
+			Name:          "FATAL",
+			Type:          MessageState,
+			State:         StateFailed,
+			Value:         "FATAL: broken",
+			Exit:          &ExitStatus{Code: 128 + int(syscall.SIGKILL), Signal: syscall.SIGKILL},
+			FailureReason: FailureReasonOutput,
+		},
+	}, unstamped(recorded))
+	assert.EqualError(t, service.Err, "FATAL: broken")
+}
+
+func TestServiceFailurePatterns(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	service := NewService("WARN", "service", []string{"lines", "WARN: slow,ERROR: broken"}, nil)
+	service.FailurePatterns = []FailurePattern{
+		{
+			Regexp:   regexp.MustCompile("^WARN"),
+			Severity: SeverityWarning,
+		},
+		{
+			Regexp:   regexp.MustCompile("^FATAL"),
+			Severity: SeverityFatal,
+		},
+	}
+	messages := service.Start(context.TODO())
+	recorded := []ServiceMessage{}
+
+	for message := range messages {
+		recorded = append(recorded, message)
+	}
+
+	assert.Equal(t, []ServiceMessage{
+		{
+			Name:  "WARN",
+			Type:  MessageState,
+			State: StateStarted,
+		},
+		{
+			Name:  "WARN",
+			Type:  MessageState,
+			State: StateRunning,
+		},
+		{
+			Name:  "WARN",
+			Type:  MessageString,
+			Value: "WARN: slow",
+		},
+		{
+			Name:  "WARN",
+			Type:  MessageWarning,
+			Value: "WARN: slow",
+		},
+		{
+			Name:  "WARN",
+			Type:  MessageString,
+			Value: "ERROR: broken",
+		},
+		{
+			Name:  "WARN",
+			Type:  MessageState,
+			State: StateFinished,
+			Exit:  &ExitStatus{},
+		},
+	}, unstamped(recorded))
+}
+
+func TestServiceLogFormat(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	service := NewService("LOGFMT", "service",
+		[]string{"lines", "level=info msg=starting,level=info msg=ready,level=ERROR msg=broken", "sleep", "5000"},
+		regexp.MustCompile("^ready$"))
+	service.LogFormat = LogFormatLogfmt
+	service.RunningField = FieldMessage
+	service.FailurePatterns = []FailurePattern{
+		{
+			Regexp:   regexp.MustCompile("^error$"),
+			Severity: SeverityFatal,
+			Field:    FieldLevel,
+		},
+	}
+	messages := service.Start(context.TODO())
+	recorded := []ServiceMessage{}
+
+	for message := range messages {
+		recorded = append(recorded, message)
+	}
+
+	assert.Equal(t, []ServiceMessage{
+		{
+			Name:  "LOGFMT",
+			Type:  MessageState,
+			State: StateStarted,
+		},
+		{
+			Name:   "LOGFMT",
+			Type:   MessageString,
+			Value:  "level=info msg=starting",
+			Fields: map[string]string{"level": "info", "msg": "starting"},
+		},
+		{
+			Name:  "LOGFMT",
+			Type:  MessageState,
+			State: StateRunning,
+		},
+		{
+			Name:   "LOGFMT",
+			Type:   MessageString,
+			Value:  "level=info msg=ready",
+			Fields: map[string]string{"level": "info", "msg": "ready"},
+		},
+		{
+			Name:   "LOGFMT",
+			Type:   MessageString,
+			Value:  "level=ERROR msg=broken",
+			Fields: map[string]string{"level": "error", "msg": "broken"},
+		},
+		{
+			Name:          "LOGFMT",
+			Type:          MessageState,
+			State:         StateFailed,
+			Value:         "level=ERROR msg=broken",
+			Exit:          &ExitStatus{Code: 128 + int(syscall.SIGKILL), Signal: syscall.SIGKILL},
+			FailureReason: FailureReasonOutput,
+		},
+	}, unstamped(recorded))
+}
+
+func TestServiceExitStatus(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	testCases := map[string]struct {
+		args         []string
+		successCodes []int
+		state        State
+		exit         *ExitStatus
+	}{
+		"exit code": {
+			args:  []string{"error"},
+			state: StateFailed,
+			exit: &ExitStatus{
+				Code: unexpectedError,
+			},
+		},
+		"success exit code": {
+			args:         []string{"error"},
+			successCodes: []int{unexpectedError},
+			state:        StateFinished,
+			exit: &ExitStatus{
+				Code: unexpectedError,
+			},
+		},
+		"signal": {
+			args:  []string{"terminate"},
+			state: StateFailed,
+			exit: &ExitStatus{
+				Code:   143,
+				Signal: syscall.SIGTERM,
+			},
+		},
+		"success signal": {
+			args:         []string{"terminate"},
+			successCodes: []int{143},
+			state:        StateFinished,
+			exit: &ExitStatus{
+				Code:   143,
+				Signal: syscall.SIGTERM,
+			},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			service := NewService("EXIT", "service", tc.args, nil)
+			service.SuccessExitCodes = tc.successCodes
+
+			var last ServiceMessage
+			for message := range service.Start(context.TODO()) {
+				last = message
+			}
+
+			assert.Equal(t, tc.state, last.State)
+			assert.Equal(t, tc.exit, last.Exit)
+			assert.Equal(t, tc.exit, service.Exit)
+		})
+	}
+}
+
+func TestServiceLongLine(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	service := NewService("LONG", "service", []string{"long", "100000", "lines", "ok"}, nil)
+	service.MaxLineLength = 10
+	messages := service.Start(context.TODO())
+	recorded := []ServiceMessage{}
+
+	for message := range messages {
+		recorded = append(recorded, message)
+	}
+
+	assert.Equal(t, []ServiceMessage{
+		{
+			Name:  "LONG",
+			Type:  MessageState,
+			State: StateStarted,
+		},
+		{
+			Name:  "LONG",
+			Type:  MessageState,
+			State: StateRunning,
+		},
+		{
+			Name:  "LONG",
+			Type:  MessageString,
+			Value: "xxxxxxxxxx [99990 bytes truncated]",
+		},
+		{
+			Name:  "LONG",
+			Type:  MessageString,
+			Value: "ok",
+		},
+		{
+			Name:  "LONG",
+			Type:  MessageState,
 			State: StateFinished,
+			Exit:  &ExitStatus{},
 		},
-	}, recorded)
+	}, unstamped(recorded))
+}
+
+func TestServiceMessageStamps(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	service := NewService("STAMP", "service", []string{"lines", "a,b,c"}, nil)
+	before := time.Now()
+	recorded := []ServiceMessage{}
+
+	for message := range service.Start(context.TODO()) {
+		recorded = append(recorded, message)
+	}
+
+	assert.Len(t, recorded, 6)
+
+	for i, message := range recorded {
+		assert.False(t, message.Time.Before(before), "message time is before start")
+
+		if i > 0 {
+			assert.Equal(t, recorded[i-1].Seq+1, message.Seq)
+			assert.False(t, message.Time.Before(recorded[i-1].Time), "message times are not ordered")
+		}
+	}
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// StartupTiming is the timeline of the last start of the service
+type StartupTiming struct {
+	// Scheduled is when the manager decided to start the service because its requirements are running,
+	// the start may be delayed by concurrency limits, see SetMaxStarting
+	Scheduled time.Time
+	// Started is when the process was started
+	Started time.Time
+	// Running is when the service reached StateRunning, zero if it did not
+	Running time.Time
+}
+
+// Wait is the time between scheduling and starting of the service
+func (t StartupTiming) Wait() time.Duration {
+	if t.Started.IsZero() {
+		return 0
+	}
+
+	return t.Started.Sub(t.Scheduled)
+}
+
+// Activation is the time between starting of the service and StateRunning
+func (t StartupTiming) Activation() time.Duration {
+	if t.Running.IsZero() {
+		return 0
+	}
+
+	return t.Running.Sub(t.Started)
+}
+
+// record updates the timeline by the state message of the service
+func (t *StartupTiming) record(message ServiceMessage) {
+	switch message.State {
+	case StateStarted:
+		// the next start or the start without scheduling, like a template with a started instance
+		if t.Scheduled.IsZero() || !t.Started.IsZero() {
+			*t = StartupTiming{Scheduled: message.Time}
+		}
+
+		t.Started = message.Time
+	case StateRunning:
+		if !t.Started.IsZero() && t.Running.IsZero() {
+			t.Running = message.Time
+		}
+	}
+}
+
+// setScheduled records the time when the start of the service was scheduled.
+// Services waiting for concurrency limits are scheduled again, the first time is kept
+func (sm *ServiceManager) setScheduled(name string, now time.Time) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	status, ok := sm.status[name]
+	if !ok {
+		return
+	}
+
+	if status.Startup.Scheduled.IsZero() || !status.Startup.Started.IsZero() {
+		status.Startup = StartupTiming{Scheduled: now}
+	}
+}
+
+// StartupEntry is the start of the service in StartupReport, times are relative to the first scheduled service
+type StartupEntry struct {
+	Name       string
+	Scheduled  time.Duration
+	Wait       time.Duration
+	Activation time.Duration
+	// Running is zero if the service did not reach StateRunning
+	Running time.Duration
+}
+
+// StartupReport is the analysis of the last start of services like systemd-analyze
+type StartupReport struct {
+	// Total is the time between the first scheduled service and the last running one
+	Total time.Duration
+	// Blame is running services without templates, the slowest activation first
+	Blame []StartupEntry
+	// CriticalPath is the chain of requirements that delayed the last running service,
+	// every service is running before its dependent is scheduled, from the first one to the last one
+	CriticalPath []StartupEntry
+}
+
+// AnalyzeStartup builds the report from the last start of every service of the status.
+// Note that a restart of a service after the stack was started makes it the last running one
+func AnalyzeStartup(status []ServiceStatus) StartupReport {
+	var (
+		report   StartupReport
+		services = make(map[string]ServiceStatus, len(status))
+		begin    time.Time
+		last     string
+	)
+
+	for _, service := range status {
+		services[service.Name] = service
+
+		timing := service.Startup
+		if timing.Started.IsZero() {
+			continue
+		}
+
+		if begin.IsZero() || timing.Scheduled.Before(begin) {
+			begin = timing.Scheduled
+		}
+
+		if !timing.Running.IsZero() && (last == "" || timing.Running.After(services[last].Startup.Running)) {
+			last = service.Name
+		}
+	}
+
+	entry := func(name string) StartupEntry {
+		timing := services[name].Startup
+		result := StartupEntry{
+			Name:       name,
+			Scheduled:  timing.Scheduled.Sub(begin),
+			Wait:       timing.Wait(),
+			Activation: timing.Activation(),
+		}
+
+		if !timing.Running.IsZero() {
+			result.Running = timing.Running.Sub(begin)
+		}
+
+		return result
+	}
+
+	for _, service := range status {
+		if service.Startup.Running.IsZero() || isTemplateName(service.Name) {
+			continue
+		}
+
+		report.Blame = append(report.Blame, entry(service.Name))
+	}
+
+	sort.SliceStable(report.Blame, func(i, j int) bool {
+		return report.Blame[i].Activation > report.Blame[j].Activation
+	})
+
+	if last == "" {
+		return report
+	}
+
+	report.Total = services[last].Startup.Running.Sub(begin)
+
+	visited := make(map[string]struct{})
+
+	for name := last; name != ""; name = criticalRequirement(name, services, visited) {
+		visited[name] = struct{}{}
+		report.CriticalPath = append([]StartupEntry{entry(name)}, report.CriticalPath...)
+	}
+
+	return report
+}
+
+// criticalRequirement returns the requirement of the service that reached StateRunning the last
+// before the service, empty if there is none
+func criticalRequirement(name string, services map[string]ServiceStatus, visited map[string]struct{}) string {
+	var (
+		running  = services[name].Startup.Running
+		critical string
+	)
+
+	for _, requirement := range services[name].Requires {
+		if _, ok := visited[requirement]; ok {
+			continue
+		}
+
+		timing := services[requirement].Startup
+		if timing.Running.IsZero() || timing.Running.After(running) {
+			continue
+		}
+
+		if critical == "" || timing.Running.After(services[critical].Startup.Running) {
+			critical = requirement
+		}
+	}
+
+	return critical
+}
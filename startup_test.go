@@ -0,0 +1,91 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeStartup(t *testing.T) {
+	begin := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time {
+		return begin.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	report := AnalyzeStartup([]ServiceStatus{
+		{Name: "api", Requires: []string{"cache", "db"}, Startup: StartupTiming{
+			Scheduled: at(900), Started: at(1000), Running: at(1500),
+		}},
+		{Name: "cache", Startup: StartupTiming{Scheduled: at(0), Started: at(0), Running: at(100)}},
+		{Name: "db", Requires: []string{"volume"}, Startup: StartupTiming{
+			Scheduled: at(100), Started: at(100), Running: at(900),
+		}},
+		{Name: "web", Requires: []string{"api"}, Startup: StartupTiming{Scheduled: at(1500), Started: at(1600)}},
+		{Name: "volume", Startup: StartupTiming{Scheduled: at(0), Started: at(0), Running: at(100)}},
+		{Name: "worker@", Requires: []string{"worker@1"}, Startup: StartupTiming{
+			Scheduled: at(0), Started: at(0), Running: at(200),
+		}},
+		{Name: "worker@1", Startup: StartupTiming{Scheduled: at(0), Started: at(0), Running: at(200)}},
+		{Name: "unused"},
+	})
+
+	ms := time.Millisecond
+
+	assert.Equal(t, 1500*ms, report.Total)
+	assert.Equal(t, []StartupEntry{
+		{Name: "db", Scheduled: 100 * ms, Activation: 800 * ms, Running: 900 * ms},
+		{Name: "api", Scheduled: 900 * ms, Wait: 100 * ms, Activation: 500 * ms, Running: 1500 * ms},
+		{Name: "worker@1", Activation: 200 * ms, Running: 200 * ms},
+		{Name: "cache", Activation: 100 * ms, Running: 100 * ms},
+		{Name: "volume", Activation: 100 * ms, Running: 100 * ms},
+	}, report.Blame)
+	assert.Equal(t, []StartupEntry{
+		{Name: "volume", Activation: 100 * ms, Running: 100 * ms},
+		{Name: "db", Scheduled: 100 * ms, Activation: 800 * ms, Running: 900 * ms},
+		{Name: "api", Scheduled: 900 * ms, Wait: 100 * ms, Activation: 500 * ms, Running: 1500 * ms},
+	}, report.CriticalPath)
+
+	assert.Equal(t, StartupReport{}, AnalyzeStartup([]ServiceStatus{{Name: "unused"}}))
+}
+
+func TestServiceManagerStartupTiming(t *testing.T) {
+	defer setHelperCommand(t)()
+
+	m := NewServiceManager()
+	ready := regexp.MustCompile("ready")
+	m.Register("A", "service", []string{"sleep", "200", "lines", "ready", "sleep", "10000"}, ready, []string{})
+	m.Register("B", "service", []string{"lines", "ready", "sleep", "10000"}, ready, []string{"A"})
+
+	messages, err := m.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go m.Start("B")
+
+	var status []ServiceStatus
+
+	for message := range messages {
+		if message.Name == "B" && message.Type == MessageState && message.State == StateRunning {
+			status = m.Status()
+
+			go m.Close()
+		}
+	}
+
+	report := AnalyzeStartup(status)
+
+	if assert.Len(t, report.CriticalPath, 2) {
+		a, b := report.CriticalPath[0], report.CriticalPath[1]
+
+		assert.Equal(t, "A", a.Name)
+		assert.Equal(t, "B", b.Name)
+		assert.True(t, a.Activation >= 200*time.Millisecond, a.Activation)
+		assert.True(t, b.Scheduled >= a.Running, b.Scheduled)
+		assert.Equal(t, b.Running, report.Total)
+	}
+
+	assert.Len(t, report.Blame, 2)
+}
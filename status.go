@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// ServiceStatus is the snapshot of the service state, see ServiceManager.Status
+type ServiceStatus struct {
+	Name  string
+	State State
+	// Pid of the last started process, zero if the process was not started
+	Pid int
+	// Since is the time of the last state change
+	Since time.Time
+	// Exit of the last process
+	Exit *ExitStatus
+	// Error is the value of the last StateFailed message
+	Error string
+	// FailureReason of the last StateFailed message
+	FailureReason FailureReason
+	// Restarts is the number of starts after the first one
+	Restarts int
+	// Requires is requirements of the service, instances for the template
+	Requires []string
+	// Resources is the last usage of the running service, nil if it is not sampled, see SetResourceSampling
+	Resources *ResourceUsage
+	// Startup is the timeline of the last start, see AnalyzeStartup
+	Startup StartupTiming
+
+	started bool
+}
+
+// Status returns states of all registered services sorted by name.
+// It is safe to call it from any goroutine
+func (sm *ServiceManager) Status() []ServiceStatus {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	result := make([]ServiceStatus, 0, len(sm.status))
+
+	for _, status := range sm.status {
+		result = append(result, *status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func (sm *ServiceManager) addStatus(name string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.status[name] = &ServiceStatus{
+		Name:  name,
+		State: StateDead,
+	}
+}
+
+func (sm *ServiceManager) removeStatus(name string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	delete(sm.status, name)
+	delete(sm.tails, name)
+}
+
+// setRequires records requirements of the service
+func (sm *ServiceManager) setRequires(name string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if status, ok := sm.status[name]; ok {
+		status.Requires = append([]string{}, sm.requirements[name]...)
+	}
+}
+
+// setPid records the process of the started service
+func (sm *ServiceManager) setPid(name string, pid int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if status, ok := sm.status[name]; ok {
+		status.Pid = pid
+	}
+}
+
+// setResources records the sampled usage of services that are still running the sampled process
+func (sm *ServiceManager) setResources(usage map[string]ResourceUsage) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for name, status := range sm.status {
+		current, ok := usage[name]
+		if !ok || current.pid != status.Pid || !isStartedState(status.State) {
+			status.Resources = nil
+			continue
+		}
+
+		status.Resources = &current
+	}
+}
+
+// recordStatus updates the status by the output message
+func (sm *ServiceManager) recordStatus(message ServiceMessage) {
+	if message.Type != MessageState {
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	status, ok := sm.status[message.Name]
+	if !ok {
+		return
+	}
+
+	status.State = message.State
+	status.Since = message.Time
+	status.Startup.record(message)
+
+	// the usage belongs to the process that is started or exited
+	if message.State != StateRunning {
+		status.Resources = nil
+	}
+
+	switch message.State {
+	case StateStarted:
+		if status.started {
+			status.Restarts++
+		}
+
+		status.started = true
+		status.Exit = nil
+		status.Error = ""
+		status.FailureReason = FailureReasonNone
+	case StateFailed:
+		status.Error = message.Value
+		status.Exit = message.Exit
+		status.FailureReason = message.FailureReason
+	case StateFinished, StateStopped:
+		status.Exit = message.Exit
+	}
+}
+
+// hasService checks that the service or the template of the instance is registered.
+// It is safe to call it from any goroutine
+func (sm *ServiceManager) hasService(name string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if _, ok := sm.status[name]; ok {
+		return true
+	}
+
+	template, instance := splitInstanceName(name)
+	_, ok := sm.status[template]
+
+	return ok && instance != ""
+}
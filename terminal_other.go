@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errTerminalUnsupported = errors.New("terminal UI is supported only on linux")
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errTerminalUnsupported
+}
+
+func terminalSize(fd int) (width, height int, err error) {
+	return 0, 0, errTerminalUnsupported
+}
+
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// tuiLogSize is the number of output lines kept for each service
+	tuiLogSize = 1000
+	// tuiFrameInterval limits the rate of redraws caused by messages
+	tuiFrameInterval = 50 * time.Millisecond
+
+	colorDim     = "\x1b[2m"
+	colorReverse = "\x1b[7m"
+
+	// alternate screen with the hidden cursor
+	screenEnter = "\x1b[?1049h\x1b[?25l\x1b[2J"
+	screenLeave = "\x1b[?25h\x1b[?1049l"
+
+	tuiHelp = " services  up/down select  PgUp/PgDn/Home/End scroll  s start  x stop  r restart  / filter  q quit"
+)
+
+// keys of the terminal input, other keys are the typed characters
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyPageUp    = "pgup"
+	keyPageDown  = "pgdown"
+	keyHome      = "home"
+	keyEnd       = "end"
+	keyEnter     = "enter"
+	keyEscape    = "esc"
+	keyBackspace = "backspace"
+	keyCtrlC     = "ctrl-c"
+)
+
+var (
+	escapeKeys = map[string]string{
+		"\x1b[A":  keyUp,
+		"\x1bOA":  keyUp,
+		"\x1b[B":  keyDown,
+		"\x1bOB":  keyDown,
+		"\x1b[5~": keyPageUp,
+		"\x1b[6~": keyPageDown,
+		"\x1b[H":  keyHome,
+		"\x1bOH":  keyHome,
+		"\x1b[1~": keyHome,
+		"\x1b[F":  keyEnd,
+		"\x1bOF":  keyEnd,
+		"\x1b[4~": keyEnd,
+	}
+
+	// ansiEscape matches colors and cursor movements in the output of services
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+)
+
+// TUIAction is the command requested by keys of TUI:
+// ControlStart, ControlStop and ControlRestart of the service or ControlShutdown of the stack
+type TUIAction struct {
+	Command string
+	Name    string
+}
+
+// TUI is MessageSink that draws the terminal UI: the list of services with their states,
+// the log of the selected service and the filter of service names.
+// Keys are turned into actions, the owner of the manager should apply them, see Actions
+type TUI struct {
+	sm   *ServiceManager
+	out  io.Writer
+	size func() (width, height int)
+
+	mu       sync.Mutex
+	logs     map[string][]tuiLine
+	selected string
+	// scroll is the number of log lines below the log pane
+	scroll int
+	// page is the height of the log pane in the last frame
+	page      int
+	filter    string
+	filtering bool
+	notice    string
+
+	redraw    chan struct{}
+	actions   chan TUIAction
+	done      chan struct{}
+	started   bool
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type tuiLine struct {
+	text  string
+	color string
+}
+
+// NewTUI creates TUI drawing to out, size returns the size of the terminal
+func NewTUI(sm *ServiceManager, out io.Writer, size func() (width, height int)) *TUI {
+	return &TUI{
+		sm:      sm,
+		out:     out,
+		size:    size,
+		logs:    make(map[string][]tuiLine),
+		redraw:  make(chan struct{}, 1),
+		actions: make(chan TUIAction, 16),
+		done:    make(chan struct{}),
+	}
+}
+
+// Actions returns actions requested by keys. Quit keys request ControlShutdown
+func (t *TUI) Actions() <-chan TUIAction {
+	return t.actions
+}
+
+// HandleMessage adds the message to the log of the service, it never blocks
+func (t *TUI) HandleMessage(message ServiceMessage) {
+	line := tuiLine{text: sanitizeLine(message.Value)}
+
+	switch message.Type {
+	case MessageState:
+		line = tuiLine{
+			text:  "--> " + sanitizeLine(formatConsoleState(message)),
+			color: colorBold + stateColor(message.State),
+		}
+	case MessageWarning:
+		line.color = colorYellow
+	}
+
+	t.mu.Lock()
+
+	lines := append(t.logs[message.Name], line)
+	if len(lines) > 2*tuiLogSize {
+		lines = append([]tuiLine(nil), lines[len(lines)-tuiLogSize:]...)
+	}
+
+	t.logs[message.Name] = lines
+
+	// the scrolled log stays in place
+	if message.Name == t.selected && t.scroll > 0 {
+		t.scroll++
+	}
+
+	t.mu.Unlock()
+
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// Start switches to the alternate screen and draws it until Close.
+// The terminal should be in raw mode, see makeRaw
+func (t *TUI) Start(in io.Reader) {
+	t.started = true
+
+	_, _ = io.WriteString(t.out, screenEnter)
+
+	keys := make(chan []byte)
+	go readInput(in, keys, t.done)
+
+	t.wg.Add(1)
+	go t.run(keys)
+}
+
+// Close stops drawing and restores the screen
+func (t *TUI) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.wg.Wait()
+
+		if t.started {
+			_, _ = io.WriteString(t.out, screenLeave)
+		}
+	})
+}
+
+func (t *TUI) run(keys <-chan []byte) {
+	defer t.wg.Done()
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	ticker := time.NewTicker(tuiFrameInterval)
+	defer ticker.Stop()
+
+	t.draw()
+
+	dirty := false
+
+	for {
+		select {
+		case data := <-keys:
+			for _, key := range parseKeys(data) {
+				t.handleKey(key)
+			}
+
+			t.draw()
+			dirty = false
+		case <-resize:
+			_, _ = io.WriteString(t.out, "\x1b[2J")
+			t.draw()
+			dirty = false
+		case <-t.redraw:
+			dirty = true
+		case <-ticker.C:
+			if dirty {
+				t.draw()
+				dirty = false
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// readInput sends chunks of the input. After done is closed it stays blocked in Read until the next key
+func readInput(in io.Reader, keys chan<- []byte, done <-chan struct{}) {
+	buf := make([]byte, 64)
+
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			select {
+			case keys <- append([]byte(nil), buf[:n]...):
+			case <-done:
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *TUI) draw() {
+	width, height := t.size()
+
+	var b strings.Builder
+
+	b.WriteString("\x1b[H")
+
+	for i, line := range t.render(width, height) {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+	}
+
+	_, _ = io.WriteString(t.out, b.String())
+}
+
+// render returns lines of the screen: the help, the list of services with the log and the status line
+func (t *TUI) render(width, height int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	services := t.visible()
+	index := t.selectedIndex(services)
+
+	body := height - 2
+	if body < 1 {
+		body = 1
+	}
+
+	t.page = body
+
+	nameWidth := 0
+	for _, service := range services {
+		if len(service.Name) > nameWidth {
+			nameWidth = len(service.Name)
+		}
+	}
+
+	// "> name state   "
+	listWidth := nameWidth + 11
+	if listWidth > width/2 {
+		listWidth = width / 2
+	}
+
+	logWidth := width - listWidth - 3
+	if logWidth < 0 {
+		logWidth = 0
+	}
+
+	logLines := t.logs[t.selected]
+	if len(logLines) > tuiLogSize {
+		logLines = logLines[len(logLines)-tuiLogSize:]
+	}
+
+	if top := len(logLines) - body; t.scroll > top {
+		t.scroll = top
+	}
+
+	if t.scroll < 0 {
+		t.scroll = 0
+	}
+
+	end := len(logLines) - t.scroll
+	start := end - body
+
+	if start < 0 {
+		start = 0
+	}
+
+	logLines = logLines[start:end]
+
+	offset := 0
+	if index >= body {
+		offset = index - body + 1
+	}
+
+	lines := make([]string, 0, height)
+	lines = append(lines, paint(colorReverse, padRight(truncateLine(tuiHelp, width), width)))
+
+	for i := 0; i < body; i++ {
+		left := padRight("", listWidth)
+		if j := offset + i; j < len(services) {
+			left = renderTUIService(services[j], j == index, listWidth)
+		}
+
+		right := ""
+		if i < len(logLines) {
+			right = paint(logLines[i].color, truncateLine(logLines[i].text, logWidth))
+		}
+
+		lines = append(lines, left+paint(colorDim, " | ")+right)
+	}
+
+	lines = append(lines, truncateLine(t.statusLine(), width))
+
+	return lines
+}
+
+func renderTUIService(service ServiceStatus, selected bool, width int) string {
+	nameWidth := width - 11
+	if nameWidth < 1 {
+		nameWidth = 1
+	}
+
+	name := padRight(truncateLine(service.Name, nameWidth), nameWidth)
+	if selected {
+		name = paint(colorReverse, "> "+name)
+	} else {
+		name = "  " + name
+	}
+
+	return name + " " + paint(stateColor(service.State), padRight(stateName(service.State), 8))
+}
+
+func (t *TUI) statusLine() string {
+	var line string
+
+	switch {
+	case t.filtering:
+		line = "/" + t.filter + "_"
+	case t.filter != "":
+		line = "filter: " + t.filter + "  (/ edit, Esc clear)"
+	default:
+		line = t.notice
+	}
+
+	if t.scroll > 0 {
+		line += fmt.Sprintf("  [%d lines below, End to follow]", t.scroll)
+	}
+
+	return line
+}
+
+// visible returns services matching the filter
+func (t *TUI) visible() []ServiceStatus {
+	services := t.sm.Status()
+	if t.filter == "" {
+		return services
+	}
+
+	filter := strings.ToLower(t.filter)
+	result := services[:0]
+
+	for _, service := range services {
+		if strings.Contains(strings.ToLower(service.Name), filter) {
+			result = append(result, service)
+		}
+	}
+
+	return result
+}
+
+// selectedIndex returns the index of the selected service, the first service is selected
+// if the selected one is not visible
+func (t *TUI) selectedIndex(services []ServiceStatus) int {
+	for i, service := range services {
+		if service.Name == t.selected {
+			return i
+		}
+	}
+
+	if len(services) == 0 {
+		t.selected = ""
+		return -1
+	}
+
+	t.selected = services[0].Name
+	t.scroll = 0
+
+	return 0
+}
+
+func (t *TUI) handleKey(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.notice = ""
+
+	if t.filtering {
+		switch key {
+		case keyEnter:
+			t.filtering = false
+		case keyEscape:
+			t.filtering = false
+			t.filter = ""
+		case keyBackspace:
+			if _, size := utf8.DecodeLastRuneInString(t.filter); size > 0 {
+				t.filter = t.filter[:len(t.filter)-size]
+			}
+		case keyCtrlC:
+			t.act(ControlShutdown, "")
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				t.filter += key
+			}
+		}
+
+		return
+	}
+
+	services := t.visible()
+	index := t.selectedIndex(services)
+
+	switch key {
+	case "q", keyCtrlC:
+		t.act(ControlShutdown, "")
+	case keyUp, "k":
+		t.selectService(services, index-1)
+	case keyDown, "j":
+		t.selectService(services, index+1)
+	case keyPageUp:
+		t.scroll += t.page
+	case keyPageDown:
+		t.scroll -= t.page
+	case keyHome:
+		// render limits it by the log size
+		t.scroll = 2 * tuiLogSize
+	case keyEnd:
+		t.scroll = 0
+	case keyEscape:
+		t.filter = ""
+	case "/":
+		t.filtering = true
+	case "s":
+		t.act(ControlStart, t.selected)
+	case "x":
+		t.act(ControlStop, t.selected)
+	case "r":
+		t.act(ControlRestart, t.selected)
+	}
+
+	if t.scroll < 0 {
+		t.scroll = 0
+	}
+}
+
+func (t *TUI) selectService(services []ServiceStatus, index int) {
+	if index < 0 || index >= len(services) {
+		return
+	}
+
+	t.selected = services[index].Name
+	t.scroll = 0
+}
+
+func (t *TUI) act(command string, name string) {
+	if command != ControlShutdown && name == "" {
+		return
+	}
+
+	select {
+	case t.actions <- TUIAction{Command: command, Name: name}:
+	default:
+		t.notice = "busy, try again"
+		return
+	}
+
+	if command == ControlShutdown {
+		t.notice = "stopping services, press q again to exit immediately"
+	} else {
+		t.notice = command + " " + name
+	}
+}
+
+// parseKeys splits the terminal input into keys, unknown escape sequences are skipped
+func parseKeys(data []byte) []string {
+	var keys []string
+
+	for len(data) > 0 {
+		if data[0] == 0x1b {
+			if len(data) == 1 || (data[1] != '[' && data[1] != 'O') {
+				keys = append(keys, keyEscape)
+				data = data[1:]
+
+				continue
+			}
+
+			// the sequence ends with a byte in the range @-~
+			i := 2
+			for i < len(data) && (data[i] < 0x40 || data[i] > 0x7e) {
+				i++
+			}
+
+			if i == len(data) {
+				break
+			}
+
+			if key, ok := escapeKeys[string(data[:i+1])]; ok {
+				keys = append(keys, key)
+			}
+
+			data = data[i+1:]
+
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+
+		switch {
+		case r == '\r' || r == '\n':
+			keys = append(keys, keyEnter)
+		case r == 0x7f || r == 0x08:
+			keys = append(keys, keyBackspace)
+		case r == 0x03:
+			keys = append(keys, keyCtrlC)
+		case r != utf8.RuneError && unicode.IsPrint(r):
+			keys = append(keys, string(r))
+		}
+	}
+
+	return keys
+}
+
+// sanitizeLine removes escape sequences and control characters of the output line
+func sanitizeLine(line string) string {
+	line = ansiEscape.ReplaceAllString(line, "")
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+
+		return r
+	}, line)
+}
+
+func truncateLine(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	return string([]rune(line)[:width])
+}
+
+func padRight(line string, width int) string {
+	if n := utf8.RuneCountInString(line); n < width {
+		return line + strings.Repeat(" ", width-n)
+	}
+
+	return line
+}
+
+func paint(color string, s string) string {
+	if color == "" {
+		return s
+	}
+
+	return color + s + colorReset
+}
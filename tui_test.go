@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeys(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected []string
+	}{
+		"characters": {
+			input:    "sx/é",
+			expected: []string{"s", "x", "/", "é"},
+		},
+		"arrows": {
+			input:    "\x1b[A\x1b[B\x1bOA",
+			expected: []string{keyUp, keyDown, keyUp},
+		},
+		"pages": {
+			input:    "\x1b[5~\x1b[6~\x1b[H\x1b[4~",
+			expected: []string{keyPageUp, keyPageDown, keyHome, keyEnd},
+		},
+		"controls": {
+			input:    "a\x7f\r\x03\x01",
+			expected: []string{"a", keyBackspace, keyEnter, keyCtrlC},
+		},
+		"escape": {
+			input:    "\x1bq\x1b",
+			expected: []string{keyEscape, "q", keyEscape},
+		},
+		"unknown sequence": {
+			input:    "\x1b[15~j\x1b[",
+			expected: []string{"j"},
+		},
+	}
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseKeys([]byte(tc.input)))
+		})
+	}
+}
+
+func TestSanitizeLine(t *testing.T) {
+	assert.Equal(t, "red text tab", sanitizeLine("\x1b[31mred\x1b[0m text\t\x07tab\r"))
+}
+
+func TestTUI(t *testing.T) {
+	m := NewServiceManager()
+	m.Register("api", "service", nil, nil, []string{"db"})
+	m.Register("db", "service", nil, nil, []string{})
+
+	tui := NewTUI(m, ioutil.Discard, func() (int, int) { return 50, 5 })
+
+	ansi := regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	render := func() string {
+		return ansi.ReplaceAllString(strings.Join(tui.render(50, 5), "\n"), "")
+	}
+	press := func(keys ...string) {
+		for _, key := range keys {
+			tui.handleKey(key)
+		}
+	}
+
+	tui.HandleMessage(ServiceMessage{Name: "db", Type: MessageState, State: StateStarted})
+	for _, line := range []string{"one", "two", "three", "four"} {
+		tui.HandleMessage(ServiceMessage{Name: "db", Type: MessageString, Value: line})
+	}
+
+	assert.Equal(t, ""+
+		" services  up/down select  PgUp/PgDn/Home/End scro\n"+
+		"> api dead     | \n"+
+		"  db  dead     | \n"+
+		"               | \n"+
+		"", render())
+
+	press(keyDown)
+	assert.Equal(t, ""+
+		" services  up/down select  PgUp/PgDn/Home/End scro\n"+
+		"  api dead     | two\n"+
+		"> db  dead     | three\n"+
+		"               | four\n"+
+		"", render())
+
+	press(keyPageUp)
+	assert.Equal(t, ""+
+		" services  up/down select  PgUp/PgDn/Home/End scro\n"+
+		"  api dead     | --> started\n"+
+		"> db  dead     | one\n"+
+		"               | two\n"+
+		"  [2 lines below, End to follow]", render())
+
+	press("r")
+	assert.Equal(t, TUIAction{Command: ControlRestart, Name: "db"}, <-tui.Actions())
+
+	press("/", "a", "p", "x", keyBackspace, keyEnter)
+	assert.Equal(t, ""+
+		" services  up/down select  PgUp/PgDn/Home/End scro\n"+
+		"> api dead     | \n"+
+		"               | \n"+
+		"               | \n"+
+		"filter: ap  (/ edit, Esc clear)", render())
+
+	press("s", "q")
+	assert.Equal(t, TUIAction{Command: ControlStart, Name: "api"}, <-tui.Actions())
+	assert.Equal(t, TUIAction{Command: ControlShutdown}, <-tui.Actions())
+
+	press(keyEscape)
+	assert.Contains(t, render(), "  db  dead")
+
+	tui.Close()
+}